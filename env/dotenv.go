@@ -0,0 +1,127 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ttab/mage/internal"
+	"github.com/ttab/mage/s3"
+	"github.com/ttab/mage/sql"
+)
+
+var nonKeyCharExp = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// Dotenv writes the connection details of the local environment to the
+// managed block of "./.env". Keys that are set outside of the block are left
+// as they are, so values set by hand take precedence. Set DOTENV_JSON to a
+// file name to also write the effective values as JSON.
+func Dotenv() error {
+	values, err := environmentValues()
+	if err != nil {
+		return err
+	}
+
+	effective, err := internal.MergeEnvFile(".env", values)
+	if err != nil {
+		return err
+	}
+
+	jsonFile := os.Getenv("DOTENV_JSON")
+	if jsonFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(effective, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal values: %w", err)
+	}
+
+	err = os.WriteFile(jsonFile, append(data, '\n'), 0o600)
+	if err != nil {
+		return fmt.Errorf("write JSON file: %w", err)
+	}
+
+	return nil
+}
+
+// environmentValues resolves the connection details of the local services.
+func environmentValues() (map[string]string, error) {
+	m, err := readManifest()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	info, err := sql.GetConnInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	// Passwords from ~/.pgpass or a service file are resolved by the
+	// clients, and shouldn't be copied to the env file.
+	values := map[string]string{
+		"CONN_STRING": info.Raw(),
+	}
+
+	backend := "minio"
+
+	var buckets []string
+
+	if store := m.ObjectStorage; store != nil {
+		if store.Backend != "" {
+			backend = store.Backend
+		}
+
+		buckets = append(buckets, store.Buckets...)
+
+		if store.BucketSpec != "" {
+			spec, err := s3.ReadBucketSpec(store.BucketSpec)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, b := range spec.Buckets {
+				buckets = append(buckets, b.Name)
+			}
+		}
+	}
+
+	switch backend {
+	case "minio":
+		cfg, err := s3.LoadMinioConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		values["S3_ENDPOINT"] = "http://" + cfg.Endpoint()
+		values["S3_ACCESS_KEY_ID"] = cfg.AccessKey
+		values["S3_SECRET_ACCESS_KEY"] = cfg.SecretKey
+	case "gcs":
+		values["STORAGE_EMULATOR_HOST"] = "localhost:4443"
+	case "azure":
+		values["AZURE_STORAGE_CONNECTION_STRING"] = fmt.Sprintf(
+			"DefaultEndpointsProtocol=http;AccountName=%s;AccountKey=%s;BlobEndpoint=http://localhost:10000/%s;",
+			s3.AzuriteAccount, s3.AzuriteKey, s3.AzuriteAccount)
+	}
+
+	slices.Sort(buckets)
+
+	buckets = slices.Compact(buckets)
+
+	if len(buckets) > 0 {
+		values["S3_BUCKETS"] = strings.Join(buckets, ",")
+	}
+
+	for _, b := range buckets {
+		key := "S3_BUCKET_" + nonKeyCharExp.ReplaceAllString(
+			strings.ToUpper(b), "_")
+
+		values[key] = b
+	}
+
+	return values, nil
+}
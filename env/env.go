@@ -0,0 +1,135 @@
+// Package env provides targets for the local development environment as a
+// whole.
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/magefile/mage/sh"
+	"github.com/ttab/mage/internal"
+)
+
+// Status lists the containers started by tt-mage with their ports, image,
+// uptime, and data directory size. Instances that have data but no container
+// are listed as stopped.
+func Status() error {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return fmt.Errorf("get state directory path: %w", err)
+	}
+
+	containers, err := internal.ManagedContainers()
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]internal.Container)
+
+	for _, c := range containers {
+		byName[c.Name] = c
+	}
+
+	dirs, err := os.ReadDir(stateDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read state directory: %w", err)
+	}
+
+	for _, d := range dirs {
+		name := d.Name()
+
+		_, known := byName[name]
+		if known || !d.IsDir() || !isManagedName(name) {
+			continue
+		}
+
+		byName[name] = internal.Container{
+			Name:     name,
+			State:    "stopped",
+			StateDir: filepath.Join(stateDir, name),
+		}
+	}
+
+	if len(byName) == 0 {
+		fmt.Println("No local service containers.")
+
+		return nil
+	}
+
+	names := make([]string, 0, len(byName))
+
+	for name := range byName {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "NAME\tSERVICE\tSTATE\tIMAGE\tPORTS\tSTATUS\tDATA\tPROJECT")
+
+	for _, name := range names {
+		c := byName[name]
+
+		data := "-"
+
+		if c.StateDir != "" {
+			size, err := internal.DirectorySize(c.StateDir)
+			if err == nil {
+				data = internal.FormatBytes(size)
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name, orDash(c.Service), c.State, orDash(c.Image),
+			orDash(c.Ports), orDash(c.Status), data, orDash(c.Project))
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("write status: %w", err)
+	}
+
+	return nil
+}
+
+// Clean stops and removes all containers started by tt-mage, the data
+// directories are kept.
+func Clean() error {
+	containers, err := internal.ManagedContainers()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		err := sh.Run("docker", "rm", "--force", c.Name)
+		if err != nil {
+			return fmt.Errorf("remove container %q: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// isManagedName matches the state directories of the local services.
+func isManagedName(name string) bool {
+	switch name {
+	case "local-minio", "local-fake-gcs", "local-azurite",
+		"local-redis", "local-opensearch":
+		return true
+	}
+
+	return strings.HasPrefix(name, "postgres-")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,256 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/magefile/mage/sh"
+	"github.com/ttab/mage/internal"
+	"github.com/ttab/mage/s3"
+	"github.com/ttab/mage/sql"
+)
+
+// Manifest declares the local services that a project depends on.
+type Manifest struct {
+	Postgres      *PostgresEnv      `json:"postgres,omitempty"`
+	ObjectStorage *ObjectStorageEnv `json:"object_storage,omitempty"`
+}
+
+// PostgresEnv declares a local Postgres instance and its databases.
+type PostgresEnv struct {
+	// Instance is the name of the local instance, defaults to "local".
+	Instance  string        `json:"instance,omitempty"`
+	Databases []DatabaseEnv `json:"databases"`
+}
+
+// DatabaseEnv declares a database on the local Postgres instance.
+type DatabaseEnv struct {
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions,omitempty"`
+	// Migrations is the directory with the tern migrations to run.
+	Migrations string `json:"migrations,omitempty"`
+	// Seed is the directory with the seed data to load after the
+	// migrations, see sql.SeedFromDir.
+	Seed string `json:"seed,omitempty"`
+}
+
+// ObjectStorageEnv declares a local object storage emulator and its buckets.
+type ObjectStorageEnv struct {
+	// Backend is "minio", "gcs", or "azure", defaults to "minio".
+	Backend string   `json:"backend,omitempty"`
+	Buckets []string `json:"buckets,omitempty"`
+	// BucketSpec is a bucket spec file for minio, see s3.Buckets.
+	BucketSpec string `json:"bucket_spec,omitempty"`
+	// Seed is a directory with a subdirectory for every bucket to seed,
+	// see s3.SeedBuckets.
+	Seed string `json:"seed,omitempty"`
+}
+
+// step is a unit of work when bringing up the environment.
+type step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Up brings up the local environment declared in "./env.json". Services are
+// started if they aren't running, and then databases are created, migrated,
+// and seeded, and buckets are created and seeded.
+func Up(ctx context.Context) error {
+	m, err := readManifest()
+	if err != nil {
+		return err
+	}
+
+	return UpWithManifest(ctx, m)
+}
+
+// UpWithManifest brings up the local environment declared in the manifest.
+func UpWithManifest(ctx context.Context, m Manifest) error {
+	steps, err := upSteps(m)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		fmt.Println("==>", s.Name)
+
+		err := s.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Down stops the containers that have been started from the current project
+// directory. The data is kept.
+func Down() error {
+	containers, err := internal.ManagedContainers()
+	if err != nil {
+		return err
+	}
+
+	project := internal.MustGetWD()
+
+	for _, c := range containers {
+		if c.Project != project {
+			continue
+		}
+
+		err := sh.Run("docker", "stop", c.Name)
+		if err != nil {
+			return fmt.Errorf("stop %q: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func readManifest() (Manifest, error) {
+	var m Manifest
+
+	data, err := os.ReadFile("env.json")
+	if err != nil {
+		return m, fmt.Errorf("read environment manifest: %w", err)
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return m, fmt.Errorf("unmarshal environment manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+// upSteps returns the steps for bringing up the environment in dependency
+// order: services are started and ready before databases and buckets are
+// created, and databases are migrated before they're seeded.
+func upSteps(m Manifest) ([]step, error) {
+	var steps []step
+
+	if pg := m.Postgres; pg != nil {
+		instance := pg.Instance
+		if instance == "" {
+			instance = "local"
+		}
+
+		steps = append(steps, step{
+			Name: "start postgres " + instance,
+			Run: func(_ context.Context) error {
+				return startIfStopped("postgres-"+instance, func() error {
+					return sql.Postgres(instance)
+				})
+			},
+		})
+
+		for _, db := range pg.Databases {
+			steps = append(steps, step{
+				Name: "create database " + db.Name,
+				Run: func(ctx context.Context) error {
+					return sql.CreateDB(ctx, db.Name, sql.DBOptions{
+						Extensions: db.Extensions,
+					})
+				},
+			})
+
+			if db.Migrations != "" {
+				steps = append(steps, step{
+					Name: "migrate database " + db.Name,
+					Run: func(_ context.Context) error {
+						return sql.MigrateDB(db.Migrations, db.Name)
+					},
+				})
+			}
+
+			if db.Seed != "" {
+				steps = append(steps, step{
+					Name: "seed database " + db.Name,
+					Run: func(ctx context.Context) error {
+						return sql.SeedFromDir(ctx,
+							sql.LocalConnString(db.Name), db.Seed)
+					},
+				})
+			}
+		}
+	}
+
+	if store := m.ObjectStorage; store != nil {
+		name := store.Backend
+		if name == "" {
+			name = "minio"
+		}
+
+		backend, err := s3.GetBackend(name)
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, step{
+			Name: "start " + name,
+			Run: func(ctx context.Context) error {
+				// The backend isn't running if it doesn't respond.
+				if backend.Ready(ctx) == nil {
+					return nil
+				}
+
+				return backend.Start(ctx)
+			},
+		})
+
+		for _, bucket := range store.Buckets {
+			steps = append(steps, step{
+				Name: "create bucket " + bucket,
+				Run: func(ctx context.Context) error {
+					return backend.CreateBucket(ctx, bucket)
+				},
+			})
+		}
+
+		if store.BucketSpec != "" {
+			if name != "minio" {
+				return nil, fmt.Errorf(
+					"bucket specs are only supported by minio, not %q", name)
+			}
+
+			steps = append(steps, step{
+				Name: "provision buckets from " + store.BucketSpec,
+				Run: func(ctx context.Context) error {
+					spec, err := s3.ReadBucketSpec(store.BucketSpec)
+					if err != nil {
+						return err
+					}
+
+					return s3.ProvisionBuckets(ctx, spec)
+				},
+			})
+		}
+
+		if store.Seed != "" {
+			steps = append(steps, step{
+				Name: "seed buckets from " + store.Seed,
+				Run: func(ctx context.Context) error {
+					return s3.SeedBuckets(ctx, backend, store.Seed)
+				},
+			})
+		}
+	}
+
+	return steps, nil
+}
+
+// startIfStopped runs start if the named container isn't running.
+func startIfStopped(name string, start func() error) error {
+	running, err := internal.ContainerRunning(name)
+	if err != nil {
+		return err
+	}
+
+	if running {
+		return nil
+	}
+
+	return start()
+}
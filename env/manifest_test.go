@@ -0,0 +1,114 @@
+package env
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUpSteps(t *testing.T) {
+	postgres := &PostgresEnv{
+		Databases: []DatabaseEnv{
+			{Name: "documents", Migrations: "schema", Seed: "seed"},
+			{Name: "reports"},
+		},
+	}
+
+	storage := &ObjectStorageEnv{
+		Buckets: []string{"archive", "images"},
+		Seed:    "buckets",
+	}
+
+	cases := []struct {
+		name     string
+		manifest Manifest
+		want     []string
+		err      string
+	}{
+		{
+			name:     "only postgres",
+			manifest: Manifest{Postgres: postgres},
+			want: []string{
+				"start postgres local",
+				"create database documents",
+				"migrate database documents",
+				"seed database documents",
+				"create database reports",
+			},
+		},
+		{
+			name:     "only object storage",
+			manifest: Manifest{ObjectStorage: storage},
+			want: []string{
+				"start minio",
+				"create bucket archive",
+				"create bucket images",
+				"seed buckets from buckets",
+			},
+		},
+		{
+			name: "both",
+			manifest: Manifest{
+				Postgres: &PostgresEnv{
+					Instance:  "other",
+					Databases: []DatabaseEnv{{Name: "documents"}},
+				},
+				ObjectStorage: &ObjectStorageEnv{
+					Backend:    "minio",
+					BucketSpec: "buckets.json",
+				},
+			},
+			want: []string{
+				"start postgres other",
+				"create database documents",
+				"start minio",
+				"provision buckets from buckets.json",
+			},
+		},
+		{
+			name: "bucket spec on another backend",
+			manifest: Manifest{
+				ObjectStorage: &ObjectStorageEnv{
+					Backend:    "gcs",
+					BucketSpec: "buckets.json",
+				},
+			},
+			err: `bucket specs are only supported by minio, not "gcs"`,
+		},
+		{
+			name: "unknown backend",
+			manifest: Manifest{
+				ObjectStorage: &ObjectStorageEnv{Backend: "ftp"},
+			},
+			err: `unknown backend "ftp"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			steps, err := upSteps(c.manifest)
+
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			names := make([]string, len(steps))
+
+			for i := range steps {
+				names[i] = steps[i].Name
+			}
+
+			if !slices.Equal(names, c.want) {
+				t.Fatalf("expected steps %q, got %q", c.want, names)
+			}
+		})
+	}
+}
@@ -4,23 +4,104 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
+// Prompter asks the user for values by writing prompts to an output and
+// reading responses from an input.
+type Prompter struct {
+	in  *bufio.Reader
+	tty *os.File
+	out io.Writer
+}
+
+// NewPrompter creates a prompter that reads responses from in and writes
+// prompts to out. Password input is only hidden if in is a terminal.
+func NewPrompter(in io.Reader, out io.Writer) *Prompter {
+	p := Prompter{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+
+	f, ok := in.(*os.File)
+	if ok {
+		stat, err := f.Stat()
+		if err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			p.tty = f
+		}
+	}
+
+	return &p
+}
+
+// std is the prompter used by the package level functions.
+var std = NewPrompter(os.Stdin, os.Stdout)
+
 // PromptForValue asks the user for a value and returns the result trimmed of
-// whitespace.
+// whitespace. Returns ErrNonInteractive if prompts have been switched off.
 func PromptForValue(prompt string, failOnEmpty bool) (string, error) {
-	reader := bufio.NewReader(os.Stdin)
+	return std.Value(prompt, failOnEmpty)
+}
 
-	fmt.Printf("%s: ", prompt)
+// PromptForValueWithDefault asks the user for a value and returns the default
+// value if the response is empty.
+func PromptForValueWithDefault(
+	prompt string, defaultValue string,
+) (string, error) {
+	return std.ValueWithDefault(prompt, defaultValue)
+}
 
-	response, err := reader.ReadString('\n')
+// PromptWithValidation asks the user for a value until it passes validation.
+func PromptWithValidation(
+	prompt string, validate func(v string) error,
+) (string, error) {
+	return std.ValidatedValue(prompt, validate)
+}
+
+// Confirm asks the user a yes/no question, an empty response is treated as a
+// no. If AssumeYesEnv is set the question is answered with yes without asking.
+func Confirm(prompt string) (bool, error) {
+	return std.Confirm(prompt)
+}
+
+// Select asks the user to pick one of the options and returns its index.
+func Select(prompt string, options []string) (int, error) {
+	return std.Select(prompt, options)
+}
+
+// MultiSelect asks the user to pick any number of the options and returns
+// their indexes.
+func MultiSelect(prompt string, options []string) ([]int, error) {
+	return std.MultiSelect(prompt, options)
+}
+
+// Password asks the user for a secret value, hiding the input when reading
+// from a terminal.
+func Password(prompt string) (string, error) {
+	return std.Password(prompt)
+}
+
+// Value asks the user for a value and returns the result trimmed of
+// whitespace. Returns ErrNonInteractive if prompts have been switched off.
+func (p *Prompter) Value(prompt string, failOnEmpty bool) (string, error) {
+	err := checkInteractive(prompt)
 	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
+		return "", err
+	}
+
+	_, _ = fmt.Fprintf(p.out, "%s: ", prompt)
+
+	response, err := p.readLine()
+	if err != nil {
+		return "", err
 	}
 
-	response = strings.TrimSpace(response)
 	if response == "" && failOnEmpty {
 		return "", errors.New("empty response")
 	}
@@ -28,14 +109,19 @@ func PromptForValue(prompt string, failOnEmpty bool) (string, error) {
 	return response, nil
 }
 
-// PromptForValueWithDefault asks the user for a value and returns the default
-// value if the response is empty.
-func PromptForValueWithDefault(
+// ValueWithDefault asks the user for a value and returns the default value if
+// the response is empty.
+func (p *Prompter) ValueWithDefault(
 	prompt string, defaultValue string,
 ) (string, error) {
-	p := fmt.Sprintf("%s [default: %s]", prompt, defaultValue)
+	err := checkInteractive(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	pr := fmt.Sprintf("%s [default: %s]", prompt, defaultValue)
 
-	response, err := PromptForValue(p, false)
+	response, err := p.Value(pr, false)
 	if err != nil {
 		return "", err
 	}
@@ -46,3 +132,238 @@ func PromptForValueWithDefault(
 
 	return response, nil
 }
+
+// ValidatedValue asks the user for a value until it passes validation. The
+// validation error is shown to the user before asking again.
+func (p *Prompter) ValidatedValue(
+	prompt string, validate func(v string) error,
+) (string, error) {
+	for {
+		response, err := p.Value(prompt, false)
+		if err != nil {
+			return "", err
+		}
+
+		err = validate(response)
+		if err == nil {
+			return response, nil
+		}
+
+		_, _ = fmt.Fprintf(p.out, "Invalid value: %v\n", err)
+	}
+}
+
+// Confirm asks the user a yes/no question, an empty response is treated as a
+// no. If AssumeYesEnv is set the question is answered with yes without asking.
+func (p *Prompter) Confirm(prompt string) (bool, error) {
+	if envIsTrue(AssumeYesEnv) {
+		return true, nil
+	}
+
+	err := checkInteractive(prompt)
+	if err != nil {
+		return false, err
+	}
+
+	var answer bool
+
+	_, err = p.ValidatedValue(prompt+" [y/N]", func(v string) error {
+		switch strings.ToLower(v) {
+		case "y", "yes":
+			answer = true
+		case "", "n", "no":
+			answer = false
+		default:
+			return errors.New("answer yes or no")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return answer, nil
+}
+
+// Select asks the user to pick one of the options and returns its index.
+func (p *Prompter) Select(prompt string, options []string) (int, error) {
+	if len(options) == 0 {
+		return 0, errors.New("no options to select from")
+	}
+
+	err := checkInteractive(prompt)
+	if err != nil {
+		return 0, err
+	}
+
+	p.listOptions(options)
+
+	var choice int
+
+	_, err = p.ValidatedValue(prompt, func(v string) error {
+		n, err := parseOption(v, len(options))
+		if err != nil {
+			return err
+		}
+
+		choice = n
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return choice, nil
+}
+
+// MultiSelect asks the user to pick any number of the options, separated by
+// commas or spaces, and returns their indexes.
+func (p *Prompter) MultiSelect(
+	prompt string, options []string,
+) ([]int, error) {
+	if len(options) == 0 {
+		return nil, errors.New("no options to select from")
+	}
+
+	err := checkInteractive(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.listOptions(options)
+
+	var choices []int
+
+	_, err = p.ValidatedValue(prompt, func(v string) error {
+		choices = nil
+
+		fields := strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+
+		for _, f := range fields {
+			n, err := parseOption(f, len(options))
+			if err != nil {
+				return err
+			}
+
+			choices = append(choices, n)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return choices, nil
+}
+
+// Password asks the user for a secret value, hiding the input when reading
+// from a terminal.
+func (p *Prompter) Password(prompt string) (string, error) {
+	err := checkInteractive(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	_, _ = fmt.Fprintf(p.out, "%s: ", prompt)
+
+	if p.tty != nil {
+		restore := hideInput(p.tty)
+
+		defer func() {
+			restore()
+			_, _ = fmt.Fprintln(p.out)
+		}()
+	}
+
+	return p.readLine()
+}
+
+// checkInteractive returns ErrNonInteractive if prompts have been switched
+// off.
+func checkInteractive(prompt string) error {
+	if NonInteractive() {
+		return fmt.Errorf("%s: %w", prompt, ErrNonInteractive)
+	}
+
+	return nil
+}
+
+func (p *Prompter) listOptions(options []string) {
+	for i, o := range options {
+		_, _ = fmt.Fprintf(p.out, "  %d) %s\n", i+1, o)
+	}
+}
+
+func (p *Prompter) readLine() (string, error) {
+	response, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || response == "") {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	return strings.TrimSpace(response), nil
+}
+
+func parseOption(v string, count int) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 || n > count {
+		return 0, fmt.Errorf("pick a number between 1 and %d", count)
+	}
+
+	return n - 1, nil
+}
+
+// hideInput switches off terminal echo and returns a function that switches
+// it back on. Echo is also switched back on if the process is interrupted or
+// terminated while the input is hidden. Echo is left on if stty isn't
+// available.
+func hideInput(tty *os.File) func() {
+	off := exec.Command("stty", "-echo")
+	off.Stdin = tty
+
+	err := off.Run()
+	if err != nil {
+		return func() {}
+	}
+
+	echoOn := func() {
+		on := exec.Command("stty", "echo")
+		on.Stdin = tty
+
+		_ = on.Run()
+	}
+
+	var (
+		signals = make(chan os.Signal, 1)
+		done    = make(chan struct{})
+	)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			echoOn()
+
+			// Raise the signal again now that we no longer intercept
+			// it, so that it gets its normal handling.
+			signal.Stop(signals)
+
+			proc, err := os.FindProcess(os.Getpid())
+			if err == nil {
+				_ = proc.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		echoOn()
+	}
+}
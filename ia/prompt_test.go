@@ -0,0 +1,114 @@
+package ia
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// interactive switches on prompts for the duration of the test, regardless
+// of the environment.
+func interactive(t *testing.T, on bool) {
+	t.Helper()
+
+	SetNonInteractive(!on)
+
+	t.Cleanup(func() {
+		m.Lock()
+		defer m.Unlock()
+
+		nonInteractive = nil
+	})
+}
+
+func TestPrompterConfirm(t *testing.T) {
+	interactive(t, true)
+	t.Setenv(AssumeYesEnv, "")
+
+	cases := []struct {
+		input string
+		want  bool
+	}{
+		{input: "y\n", want: true},
+		{input: "YES\n", want: true},
+		{input: "n\n", want: false},
+		{input: "\n", want: false},
+		{input: "maybe\nyes\n", want: true},
+	}
+
+	for _, c := range cases {
+		t.Run(strings.TrimSpace(c.input), func(t *testing.T) {
+			var out strings.Builder
+
+			p := NewPrompter(strings.NewReader(c.input), &out)
+
+			got, err := p.Confirm("Continue")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != c.want {
+				t.Fatalf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestPrompterSelect(t *testing.T) {
+	interactive(t, true)
+
+	var out strings.Builder
+
+	p := NewPrompter(strings.NewReader("0\n4\n2\n"), &out)
+
+	got, err := p.Select("Pick one", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got != 1 {
+		t.Fatalf("expected 1, got %d", got)
+	}
+
+	if n := strings.Count(out.String(), "pick a number between 1 and 3"); n != 2 {
+		t.Fatalf("expected two validation errors, got %d in %q",
+			n, out.String())
+	}
+}
+
+func TestPrompterMultiSelect(t *testing.T) {
+	interactive(t, true)
+
+	p := NewPrompter(strings.NewReader("1, 3 2\n"), &strings.Builder{})
+
+	got, err := p.MultiSelect("Pick any", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []int{0, 2, 1}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPrompterNonInteractive(t *testing.T) {
+	interactive(t, false)
+	t.Setenv(AssumeYesEnv, "")
+
+	p := NewPrompter(strings.NewReader("y\n"), &strings.Builder{})
+
+	_, err := p.Confirm("Continue")
+	if !errors.Is(err, ErrNonInteractive) {
+		t.Fatalf("expected ErrNonInteractive, got %v", err)
+	}
+
+	t.Setenv(AssumeYesEnv, "true")
+
+	ok, err := p.Confirm("Continue")
+	if err != nil || !ok {
+		t.Fatalf("expected an assumed yes, got %v, %v", ok, err)
+	}
+}
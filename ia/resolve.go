@@ -0,0 +1,184 @@
+package ia
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// NonInteractiveEnv is the environment variable that switches off interactive
+// prompts when set to a true value. Prompts are also switched off when the
+// CI environment variable is true.
+const NonInteractiveEnv = "TT_MAGE_NON_INTERACTIVE"
+
+// AssumeYesEnv is the environment variable that answers yes to all
+// confirmations when set to a true value.
+const AssumeYesEnv = "TT_MAGE_ASSUME_YES"
+
+// ErrNonInteractive is returned when a value would have to be prompted for in
+// non-interactive mode.
+var ErrNonInteractive = errors.New("interactive prompt in non-interactive mode")
+
+var (
+	m              sync.Mutex
+	nonInteractive *bool
+	presets        = make(map[string]string)
+)
+
+// SetNonInteractive switches interactive prompts on or off, overriding the
+// environment.
+func SetNonInteractive(v bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	nonInteractive = &v
+}
+
+// NonInteractive returns true if interactive prompts have been switched off.
+func NonInteractive() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	if nonInteractive != nil {
+		return *nonInteractive
+	}
+
+	return envIsTrue(NonInteractiveEnv) || envIsTrue("CI")
+}
+
+// SetValue presets the value for a prompt key, taking precedence over the
+// environment. Use this to pass values that have been parsed from flags.
+func SetValue(key string, value string) {
+	m.Lock()
+	defer m.Unlock()
+
+	presets[key] = value
+}
+
+// Prompt describes a value that can be provided through a preset value, an
+// environment variable, or by asking the user.
+type Prompt struct {
+	// Label is shown to the user when prompting for the value.
+	Label string
+	// Key is the name of the environment variable, and the key used
+	// with SetValue, that the value is resolved from before prompting.
+	Key string
+	// Default is used when the user gives an empty response, or when no
+	// value is available in non-interactive mode.
+	Default string
+	// Required makes empty values an error in non-interactive mode, the
+	// user will be asked again if they give an empty response.
+	Required bool
+	// Secret hides the input when prompting in a terminal.
+	Secret bool
+	// Validate is an optional validation function. The user will be asked
+	// again if an entered value fails validation.
+	Validate func(v string) error
+}
+
+// Resolve returns the value for a prompt, checking preset values and the
+// environment before asking the user. In non-interactive mode a missing
+// required value is an error.
+func Resolve(p Prompt) (string, error) {
+	return std.Resolve(p)
+}
+
+// Resolve returns the value for a prompt like the package level Resolve, but
+// asks the user through the prompter.
+func (p *Prompter) Resolve(prompt Prompt) (string, error) {
+	if prompt.Key != "" {
+		m.Lock()
+		v, ok := presets[prompt.Key]
+		m.Unlock()
+
+		if !ok {
+			v = os.Getenv(prompt.Key)
+		}
+
+		if v != "" {
+			return v, prompt.validate(v)
+		}
+	}
+
+	if NonInteractive() {
+		if prompt.Default != "" || !prompt.Required {
+			return prompt.Default, nil
+		}
+
+		if prompt.Key == "" {
+			return "", fmt.Errorf("no value for %q: %w",
+				prompt.Label, ErrNonInteractive)
+		}
+
+		return "", fmt.Errorf("no value for %q, set %s: %w",
+			prompt.Label, prompt.Key, ErrNonInteractive)
+	}
+
+	for {
+		v, err := p.ask(prompt)
+		if err != nil {
+			return "", err
+		}
+
+		if v == "" && prompt.Required {
+			_, _ = fmt.Fprintf(p.out, "A value for %q is required\n",
+				prompt.Label)
+
+			continue
+		}
+
+		err = prompt.validate(v)
+		if err == nil {
+			return v, nil
+		}
+
+		_, _ = fmt.Fprintln(p.out, err)
+	}
+}
+
+func (p *Prompter) ask(prompt Prompt) (string, error) {
+	var (
+		v   string
+		err error
+	)
+
+	switch {
+	case prompt.Secret:
+		v, err = p.Password(prompt.Label)
+	case prompt.Default != "":
+		v, err = p.ValueWithDefault(prompt.Label, prompt.Default)
+	default:
+		v, err = p.Value(prompt.Label, false)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if v == "" {
+		v = prompt.Default
+	}
+
+	return v, nil
+}
+
+func (p Prompt) validate(v string) error {
+	if p.Validate == nil {
+		return nil
+	}
+
+	err := p.Validate(v)
+	if err != nil {
+		return fmt.Errorf("invalid value for %q: %w", p.Label, err)
+	}
+
+	return nil
+}
+
+func envIsTrue(name string) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
+
+	return err == nil && v
+}
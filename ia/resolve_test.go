@@ -0,0 +1,147 @@
+package ia
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPrompterResolve(t *testing.T) {
+	notEmail := func(v string) error {
+		if !strings.Contains(v, "@") {
+			return errors.New("not an email address")
+		}
+
+		return nil
+	}
+
+	cases := []struct {
+		name           string
+		prompt         Prompt
+		env            string
+		preset         string
+		input          string
+		nonInteractive bool
+		want           string
+		err            error
+	}{
+		{
+			name:   "environment",
+			prompt: Prompt{Label: "Role", Key: "TEST_RESOLVE_ROLE"},
+			env:    "reporting",
+			want:   "reporting",
+		},
+		{
+			name:   "preset before environment",
+			prompt: Prompt{Label: "Role", Key: "TEST_RESOLVE_ROLE"},
+			env:    "reporting",
+			preset: "admin",
+			want:   "admin",
+		},
+		{
+			name:   "prompt",
+			prompt: Prompt{Label: "Role", Key: "TEST_RESOLVE_ROLE"},
+			input:  "writer\n",
+			want:   "writer",
+		},
+		{
+			name: "default on empty response",
+			prompt: Prompt{
+				Label: "Role", Key: "TEST_RESOLVE_ROLE", Default: "reader",
+			},
+			input: "\n",
+			want:  "reader",
+		},
+		{
+			name: "asks again after failed validation",
+			prompt: Prompt{
+				Label: "Email", Key: "TEST_RESOLVE_ROLE",
+				Validate: notEmail,
+			},
+			input: "nope\nme@example.com\n",
+			want:  "me@example.com",
+		},
+		{
+			name: "asks again after empty required value",
+			prompt: Prompt{
+				Label: "Role", Key: "TEST_RESOLVE_ROLE", Required: true,
+			},
+			input: "\n\nwriter\n",
+			want:  "writer",
+		},
+		{
+			name: "asks again after empty required secret",
+			prompt: Prompt{
+				Label: "Password", Key: "TEST_RESOLVE_ROLE",
+				Required: true, Secret: true,
+			},
+			input: "\nsecret\n",
+			want:  "secret",
+		},
+		{
+			name: "fails on end of input",
+			prompt: Prompt{
+				Label: "Password", Key: "TEST_RESOLVE_ROLE",
+				Required: true, Secret: true,
+			},
+			input: "\n",
+			err:   io.EOF,
+		},
+		{
+			name: "non-interactive default",
+			prompt: Prompt{
+				Label: "Role", Key: "TEST_RESOLVE_ROLE",
+				Default: "reader", Required: true,
+			},
+			nonInteractive: true,
+			want:           "reader",
+		},
+		{
+			name: "non-interactive required",
+			prompt: Prompt{
+				Label: "Role", Key: "TEST_RESOLVE_ROLE", Required: true,
+			},
+			nonInteractive: true,
+			err:            ErrNonInteractive,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			interactive(t, !c.nonInteractive)
+			t.Setenv(c.prompt.Key, c.env)
+
+			if c.preset != "" {
+				SetValue(c.prompt.Key, c.preset)
+
+				t.Cleanup(func() {
+					m.Lock()
+					defer m.Unlock()
+
+					delete(presets, c.prompt.Key)
+				})
+			}
+
+			p := NewPrompter(strings.NewReader(c.input), &strings.Builder{})
+
+			got, err := p.Resolve(c.prompt)
+
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("expected %v, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != c.want {
+				t.Fatalf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
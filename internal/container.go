@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/magefile/mage/sh"
+)
+
+// Labels that are set on all containers started by RunContainer.
+const (
+	LabelTool     = "tt-mage.tool"
+	LabelProject  = "tt-mage.project"
+	LabelService  = "tt-mage.service"
+	LabelStateDir = "tt-mage.state-dir"
+)
+
+// ToolName is the value of the LabelTool label.
+const ToolName = "tt-mage"
+
+// ContainerOptions describes a container to start with RunContainer.
+type ContainerOptions struct {
+	Name string
+	// Service is the kind of service, f.ex. "postgres" or "minio".
+	Service string
+	Image   string
+	// StateDir is the directory where the container keeps its data.
+	StateDir string
+	// Ports are published ports as "host:container".
+	Ports []string
+	// Env are environment variables for the container. They're passed
+	// by name to keep the values out of the command line.
+	Env map[string]string
+	// Args are additional arguments for "docker run", f.ex. volumes and
+	// environment variables.
+	Args []string
+	// Command is the command and arguments for the image.
+	Command []string
+}
+
+// RunContainer starts a labelled container in the background, replacing an
+// existing container with the same name that was started by tt-mage. Fails if
+// the name is taken by a container that wasn't started by tt-mage, or if a
+// host port is in use.
+func RunContainer(opts ContainerOptions) error {
+	managed, exists, err := containerManaged(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if exists && !managed {
+		return fmt.Errorf(
+			"the container name %q is used by a container that wasn't started by tt-mage, remove it with \"docker rm -f %s\"",
+			opts.Name, opts.Name)
+	}
+
+	err = StopContainerIfExists(opts.Name)
+	if err != nil {
+		return fmt.Errorf("stop existing container: %w", err)
+	}
+
+	for _, p := range opts.Ports {
+		hostPort, _, _ := strings.Cut(p, ":")
+
+		err := checkPortFree(hostPort)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := []string{"run", "-d", "--rm",
+		"--name", opts.Name,
+		"--label", LabelTool + "=" + ToolName,
+		"--label", LabelProject + "=" + MustGetWD(),
+		"--label", LabelService + "=" + opts.Service,
+		"--label", LabelStateDir + "=" + opts.StateDir,
+	}
+
+	for _, p := range opts.Ports {
+		args = append(args, "-p", p)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(opts.Env)) {
+		args = append(args, "-e", name)
+	}
+
+	args = append(args, opts.Args...)
+	args = append(args, opts.Image)
+	args = append(args, opts.Command...)
+
+	err = sh.RunWith(opts.Env, "docker", args...)
+	if err != nil {
+		return fmt.Errorf("start %s: %w", opts.Service, err)
+	}
+
+	return nil
+}
+
+// containerManaged checks if a container exists and if it was started by
+// tt-mage.
+func containerManaged(name string) (managed bool, exists bool, err error) {
+	out, err := OutputSilent("docker", "inspect",
+		"--format", fmt.Sprintf(`{{index .Config.Labels %q}}`, LabelTool),
+		name)
+	if err != nil {
+		_, vErr := OutputSilent("docker", "version")
+		if vErr != nil {
+			return false, false, fmt.Errorf("run docker: %w", vErr)
+		}
+
+		return false, false, nil
+	}
+
+	return out == ToolName, true, nil
+}
+
+// checkPortFree checks that nothing is listening on a host port and names
+// the container that has published it if there is one.
+func checkPortFree(port string) error {
+	l, err := net.Listen("tcp", ":"+port)
+	if err == nil {
+		_ = l.Close()
+
+		return nil
+	}
+
+	holder, _ := OutputSilent("docker", "ps",
+		"--filter", "publish="+port, "--format", "{{.Names}}")
+	if holder != "" {
+		return fmt.Errorf("port %s is already published by the container %q",
+			port, strings.ReplaceAll(holder, "\n", ", "))
+	}
+
+	return fmt.Errorf("port %s is already in use", port)
+}
+
+// Container describes a docker container.
+type Container struct {
+	Name     string
+	Image    string
+	Ports    string
+	State    string
+	Status   string
+	Service  string
+	Project  string
+	StateDir string
+}
+
+// ManagedContainers lists the containers that were started by tt-mage.
+func ManagedContainers() ([]Container, error) {
+	format := strings.Join([]string{
+		"{{.Names}}", "{{.Image}}", "{{.Ports}}",
+		"{{.State}}", "{{.Status}}",
+		fmt.Sprintf("{{.Label %q}}", LabelService),
+		fmt.Sprintf("{{.Label %q}}", LabelProject),
+		fmt.Sprintf("{{.Label %q}}", LabelStateDir),
+	}, "\t")
+
+	out, err := OutputSilent("docker", "ps", "--all",
+		"--filter", "label="+LabelTool+"="+ToolName,
+		"--format", format)
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+
+	var containers []Container
+
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 8 {
+			return nil, fmt.Errorf("unexpected docker ps output: %q", line)
+		}
+
+		containers = append(containers, Container{
+			Name:     fields[0],
+			Image:    fields[1],
+			Ports:    fields[2],
+			State:    fields[3],
+			Status:   fields[4],
+			Service:  fields[5],
+			Project:  fields[6],
+			StateDir: fields[7],
+		})
+	}
+
+	return containers, nil
+}
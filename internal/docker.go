@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/magefile/mage/sh"
 )
@@ -26,3 +30,77 @@ func StopContainerIfExists(name string) error {
 
 	return nil
 }
+
+// ContainerRunning checks if the named container exists and is running.
+func ContainerRunning(name string) (bool, error) {
+	out, err := OutputSilent("docker", "inspect",
+		"--format", "{{.State.Running}}", name)
+	if err != nil {
+		// docker inspect fails for containers that don't exist, check
+		// that docker itself is available.
+		_, vErr := OutputSilent("docker", "version")
+		if vErr != nil {
+			return false, fmt.Errorf("run docker: %w", vErr)
+		}
+
+		return false, nil
+	}
+
+	return out == "true", nil
+}
+
+// ContainerLogs follows the logs of the named container.
+func ContainerLogs(name string) error {
+	running, err := ContainerRunning(name)
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		return fmt.Errorf("the container %q isn't running", name)
+	}
+
+	err = sh.RunV("docker", "logs", "--follow", "--tail", "100", name)
+	if err != nil {
+		return fmt.Errorf("get container logs: %w", err)
+	}
+
+	return nil
+}
+
+// ContainerExec runs a command in a running container. The environment
+// variables are passed by name to keep the values out of the command line,
+// and the output is included in the error if the command fails.
+func ContainerExec(
+	name string, env map[string]string, stdin io.Reader, args ...string,
+) (string, error) {
+	dockerArgs := []string{"exec"}
+
+	if stdin != nil {
+		dockerArgs = append(dockerArgs, "-i")
+	}
+
+	for k := range env {
+		dockerArgs = append(dockerArgs, "-e", k)
+	}
+
+	dockerArgs = append(dockerArgs, name)
+	dockerArgs = append(dockerArgs, args...)
+
+	cmd := exec.Command("docker", dockerArgs...)
+
+	cmd.Stdin = stdin
+	cmd.Env = os.Environ()
+
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("%s: %w: %s",
+			strings.Join(args, " "), err, bytes.TrimSpace(out))
+	}
+
+	return string(out), nil
+}
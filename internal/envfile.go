@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// UpdateEnvFile sets the values in a dotenv file, replacing the lines that
+// already set the keys outside of the managed block (see MergeEnvFile) and
+// appending the others. The file is created if it doesn't exist.
+func UpdateEnvFile(name string, values map[string]string) error {
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read env file: %w", err)
+	}
+
+	var lines []string
+
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	var (
+		written = make(map[string]bool)
+		inBlock bool
+	)
+
+	for i, line := range lines {
+		// Values in the managed block would be lost when it's
+		// regenerated by MergeEnvFile.
+		switch line {
+		case managedBlockStart:
+			inBlock = true
+		case managedBlockEnd:
+			inBlock = false
+		}
+
+		key, _, ok := parseEnvLine(line)
+		if !ok || inBlock {
+			continue
+		}
+
+		v, set := values[key]
+		if !set {
+			continue
+		}
+
+		lines[i] = key + "=" + quoteEnvValue(v)
+		written[key] = true
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if written[key] {
+			continue
+		}
+
+		lines = append(lines, key+"="+quoteEnvValue(values[key]))
+	}
+
+	err = os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	if err != nil {
+		return fmt.Errorf("write env file: %w", err)
+	}
+
+	return nil
+}
+
+// quoteEnvValue quotes values that contain whitespace or special characters.
+func quoteEnvValue(v string) string {
+	if !strings.ContainsAny(v, " \t\n\"'#$\\`") {
+		return v
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`)
+
+	return `"` + r.Replace(v) + `"`
+}
+
+const (
+	managedBlockStart = "# BEGIN tt-mage managed values"
+	managedBlockEnd   = "# END tt-mage managed values"
+)
+
+// MergeEnvFile writes the values to a managed block in a dotenv file. The
+// block is replaced every time, and keys that are set outside of the block
+// are left as they are and omitted from the block, so that values set by the
+// user take precedence. Returns the effective values of all keys in the file.
+func MergeEnvFile(
+	name string, values map[string]string,
+) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+
+	var (
+		kept    []string
+		inBlock bool
+	)
+
+	effective := make(map[string]string)
+
+	if len(data) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			switch {
+			case line == managedBlockStart:
+				inBlock = true
+				kept = trimBlankLines(kept)
+
+				continue
+			case line == managedBlockEnd:
+				inBlock = false
+
+				continue
+			case inBlock:
+				continue
+			}
+
+			kept = append(kept, line)
+
+			key, value, ok := parseEnvLine(line)
+			if ok {
+				effective[key] = value
+			}
+		}
+	}
+
+	kept = trimBlankLines(kept)
+
+	block := []string{managedBlockStart}
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if _, userValue := effective[key]; userValue {
+			continue
+		}
+
+		effective[key] = values[key]
+
+		block = append(block, key+"="+quoteEnvValue(values[key]))
+	}
+
+	block = append(block, managedBlockEnd)
+
+	lines := kept
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, block...)
+
+	err = os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("write env file: %w", err)
+	}
+
+	return effective, nil
+}
+
+// trimBlankLines removes trailing blank lines, f.ex. the separator before a
+// managed block.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// parseEnvLine parses a KEY=value line, unquoting quoted values.
+func parseEnvLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+
+	key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+	value = strings.TrimSpace(value)
+
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		r := strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\$`, "$", `\n`, "\n")
+
+		value = r.Replace(value[1 : len(value)-1])
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		value = value[1 : len(value)-1]
+	}
+
+	return key, value, true
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseEnvLine(t *testing.T) {
+	cases := []struct {
+		line  string
+		key   string
+		value string
+		ok    bool
+	}{
+		{line: "A=b", key: "A", value: "b", ok: true},
+		{line: "  A = b  ", key: "A", value: "b", ok: true},
+		{line: "export A=b", key: "A", value: "b", ok: true},
+		{line: "A=", key: "A", value: "", ok: true},
+		{line: "A=a=b", key: "A", value: "a=b", ok: true},
+		{line: `A="a \"b\" \$c\nd\\"`, key: "A", value: "a \"b\" $c\nd\\", ok: true},
+		{line: `A='a $b'`, key: "A", value: "a $b", ok: true},
+		{line: "", ok: false},
+		{line: "# A=b", ok: false},
+		{line: "A", ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.line, func(t *testing.T) {
+			key, value, ok := parseEnvLine(c.line)
+			if ok != c.ok || key != c.key || value != c.value {
+				t.Fatalf("expected %q, %q, %v, got %q, %q, %v",
+					c.key, c.value, c.ok, key, value, ok)
+			}
+		})
+	}
+}
+
+func TestQuoteEnvValue(t *testing.T) {
+	for _, v := range []string{"plain", "a b", `"quoted"`, "$HOME", "a\nb", `c:\dir`} {
+		t.Run(v, func(t *testing.T) {
+			_, got, _ := parseEnvLine("A=" + quoteEnvValue(v))
+			if got != v {
+				t.Fatalf("expected %q to round trip, got %q", v, got)
+			}
+		})
+	}
+}
+
+func TestMergeEnvFile(t *testing.T) {
+	cases := []struct {
+		name      string
+		existing  string
+		values    map[string]string
+		want      string
+		effective map[string]string
+	}{
+		{
+			name:   "new file",
+			values: map[string]string{"B": "2", "A": "1"},
+			want: `# BEGIN tt-mage managed values
+A=1
+B=2
+# END tt-mage managed values
+`,
+			effective: map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name: "replaces the block",
+			existing: `# BEGIN tt-mage managed values
+A=old
+C=removed
+# END tt-mage managed values
+`,
+			values: map[string]string{"A": "1"},
+			want: `# BEGIN tt-mage managed values
+A=1
+# END tt-mage managed values
+`,
+			effective: map[string]string{"A": "1"},
+		},
+		{
+			name: "user values take precedence",
+			existing: `# My settings
+A="from user"
+
+# BEGIN tt-mage managed values
+A=1
+B=old
+# END tt-mage managed values
+
+OTHER=x
+`,
+			values: map[string]string{"A": "1", "B": "2"},
+			want: `# My settings
+A="from user"
+
+OTHER=x
+
+# BEGIN tt-mage managed values
+B=2
+# END tt-mage managed values
+`,
+			effective: map[string]string{
+				"A": "from user", "B": "2", "OTHER": "x",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), ".env")
+
+			if c.existing != "" {
+				err := os.WriteFile(name, []byte(c.existing), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			effective, err := MergeEnvFile(name, c.values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != c.want {
+				t.Fatalf("expected file:\n%s\ngot:\n%s", c.want, data)
+			}
+
+			if !reflect.DeepEqual(effective, c.effective) {
+				t.Fatalf("expected effective values %v, got %v",
+					c.effective, effective)
+			}
+		})
+	}
+}
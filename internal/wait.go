@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// waitAttemptTimeout limits the time a single readiness check may take, so
+// that a hanging request doesn't use up the whole timeout.
+const waitAttemptTimeout = 5 * time.Second
+
+// WaitFor polls check until it succeeds or the timeout is reached. Every
+// check gets a context that is cancelled after a few seconds.
+func WaitFor(
+	ctx context.Context, service string, timeout time.Duration,
+	check func(ctx context.Context) error,
+) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := attempt(ctx, check)
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("failed to ensure that %s is available: %w",
+				service, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+}
+
+func attempt(ctx context.Context, check func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, waitAttemptTimeout)
+	defer cancel()
+
+	return check(ctx)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitFor(t *testing.T) {
+	var attempts int
+
+	err := WaitFor(context.Background(), "service", time.Second,
+		func(ctx context.Context) error {
+			attempts++
+
+			_, hasDeadline := ctx.Deadline()
+			if !hasDeadline {
+				t.Fatal("expected the attempt to have a deadline")
+			}
+
+			if attempts < 3 {
+				return errors.New("not ready")
+			}
+
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	err := WaitFor(context.Background(), "service", 100*time.Millisecond,
+		func(_ context.Context) error {
+			return errors.New("not ready")
+		})
+	if err == nil || !strings.Contains(err.Error(),
+		"failed to ensure that service is available: not ready") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
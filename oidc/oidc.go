@@ -0,0 +1,166 @@
+// Package oidc provides targets for running a local OpenID Connect provider
+// that can mint test tokens.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ttab/mage/internal"
+)
+
+const (
+	mockServerImage = "ghcr.io/navikt/mock-oauth2-server:2.1.10"
+	instanceName    = "local-oidc"
+	endpoint        = "http://localhost:8089"
+	issuerID        = "default"
+)
+
+// Issuer is the issuer URL of the local OIDC provider. The discovery document
+// is published at Issuer + "/.well-known/openid-configuration".
+const Issuer = endpoint + "/" + issuerID
+
+// tokenConfig makes the scope and subject of client credential token
+// requests end up in the "scope" and "sub" claims.
+const tokenConfig = `{
+  "interactiveLogin": false,
+  "tokenCallbacks": [
+    {
+      "issuerId": "default",
+      "tokenExpiry": 3600,
+      "requestMappings": [
+        {
+          "requestParam": "grant_type",
+          "match": "*",
+          "claims": {
+            "sub": "${clientId}",
+            "scope": "${scope}",
+            "aud": ["local"]
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+// OIDC starts a local OpenID Connect provider using docker. The provider
+// doesn't keep any state.
+func OIDC(ctx context.Context) error {
+	err := internal.RunContainer(internal.ContainerOptions{
+		Name:    instanceName,
+		Service: "oidc",
+		Image:   mockServerImage,
+		Ports:   []string{"8089:8080"},
+		Env: map[string]string{
+			"JSON_CONFIG": tokenConfig,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = internal.WaitFor(ctx, "oidc", 30*time.Second, discovery)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Issuer:", Issuer)
+
+	return nil
+}
+
+// Stop stops the local OpenID Connect provider.
+func Stop() error {
+	err := internal.StopContainerIfExists(instanceName)
+	if err != nil {
+		return fmt.Errorf("stop oidc: %w", err)
+	}
+
+	return nil
+}
+
+// Token mints an access token for the subject with the scopes in the space
+// separated list, and prints it.
+func Token(ctx context.Context, subject string, scopes string) error {
+	token, err := MintToken(ctx, subject, strings.Fields(scopes))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+
+	return nil
+}
+
+// MintToken requests an access token for the subject with the given scopes
+// from the local OpenID Connect provider.
+func MintToken(
+	ctx context.Context, subject string, scopes []string,
+) (string, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {subject},
+		"client_secret": {"local"},
+		"scope":         {strings.Join(scopes, " ")},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		Issuer+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request token: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+		return "", fmt.Errorf("request token: %s: %s",
+			res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+
+	return body.AccessToken, nil
+}
+
+func discovery(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("get discovery document: %w", err)
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get discovery document: %s", res.Status)
+	}
+
+	return nil
+}
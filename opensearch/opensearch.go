@@ -0,0 +1,173 @@
+// Package opensearch provides targets for running a local OpenSearch
+// instance.
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ttab/mage/internal"
+)
+
+const (
+	openSearchImage = "docker.io/opensearchproject/opensearch:2.19.1"
+	instanceName    = "local-opensearch"
+	endpoint        = "http://localhost:9200"
+)
+
+// OpenSearch creates a local single node OpenSearch instance using docker,
+// with the security plugin disabled. The index templates in
+// "./opensearch/templates" are loaded when the instance is ready.
+func OpenSearch(ctx context.Context) error {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return fmt.Errorf("get state directory path: %w", err)
+	}
+
+	dataDir := filepath.Join(stateDir, instanceName)
+
+	err = os.MkdirAll(dataDir, 0o700)
+	if err != nil {
+		return fmt.Errorf("create local state directory: %w", err)
+	}
+
+	err = internal.RunContainer(internal.ContainerOptions{
+		Name:     instanceName,
+		Service:  "opensearch",
+		Image:    openSearchImage,
+		StateDir: dataDir,
+		Ports:    []string{"9200:9200"},
+		Args: []string{
+			"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			"-e", "discovery.type=single-node",
+			"-e", "DISABLE_SECURITY_PLUGIN=true",
+			"-e", "DISABLE_INSTALL_DEMO_CONFIG=true",
+			"-e", "OPENSEARCH_JAVA_OPTS=-Xms512m -Xmx512m",
+			"-v", fmt.Sprintf("%s:/usr/share/opensearch/data", dataDir),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = internal.WaitFor(ctx, "opensearch", 90*time.Second, clusterHealth)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(templateDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return IndexTemplates(ctx)
+}
+
+// Stop stops the local OpenSearch instance, the data is kept.
+func Stop() error {
+	err := internal.StopContainerIfExists(instanceName)
+	if err != nil {
+		return fmt.Errorf("stop opensearch: %w", err)
+	}
+
+	return nil
+}
+
+// IndexTemplates loads the index templates in "./opensearch/templates" into
+// the local OpenSearch instance. Every JSON file is a composable index
+// template named after the file, existing templates are replaced.
+func IndexTemplates(ctx context.Context) error {
+	files, err := filepath.Glob(filepath.Join(templateDir(), "*.json"))
+	if err != nil {
+		return fmt.Errorf("list index templates: %w", err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read index template: %w", err)
+		}
+
+		if !json.Valid(data) {
+			return fmt.Errorf("%q is not valid JSON", file)
+		}
+
+		err = request(ctx, http.MethodPut, "/_index_template/"+name, data, nil)
+		if err != nil {
+			return fmt.Errorf("put index template %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func templateDir() string {
+	return filepath.Join("opensearch", "templates")
+}
+
+// clusterHealth checks that the cluster responds and isn't red.
+func clusterHealth(ctx context.Context) error {
+	var health struct {
+		Status string `json:"status"`
+	}
+
+	err := request(ctx, http.MethodGet, "/_cluster/health", nil, &health)
+	if err != nil {
+		return err
+	}
+
+	if health.Status == "red" {
+		return errors.New("cluster status is red")
+	}
+
+	return nil
+}
+
+// request sends a JSON request to the local instance and decodes the response
+// into result if it isn't nil.
+func request(
+	ctx context.Context, method string, path string, body []byte, result any,
+) error {
+	req, err := http.NewRequestWithContext(
+		ctx, method, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("perform request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(res.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
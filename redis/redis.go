@@ -0,0 +1,97 @@
+// Package redis provides targets for running a local Valkey instance, a Redis
+// compatible key-value store.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ttab/mage/internal"
+)
+
+const (
+	valkeyImage  = "docker.io/valkey/valkey:8.1"
+	instanceName = "local-redis"
+	addr         = "localhost:6379"
+)
+
+// Redis creates a local Valkey instance using docker, with append-only
+// persistence in the state directory.
+func Redis(ctx context.Context) error {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return fmt.Errorf("get state directory path: %w", err)
+	}
+
+	dataDir := filepath.Join(stateDir, instanceName)
+
+	err = os.MkdirAll(dataDir, 0o700)
+	if err != nil {
+		return fmt.Errorf("create local state directory: %w", err)
+	}
+
+	err = internal.RunContainer(internal.ContainerOptions{
+		Name:     instanceName,
+		Service:  "redis",
+		Image:    valkeyImage,
+		StateDir: dataDir,
+		Ports:    []string{"6379:6379"},
+		Args: []string{
+			"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			"-v", fmt.Sprintf("%s:/data", dataDir),
+		},
+		Command: []string{"valkey-server", "--appendonly", "yes"},
+	})
+	if err != nil {
+		return err
+	}
+
+	return internal.WaitFor(ctx, "redis", 20*time.Second, ping)
+}
+
+// Stop stops the local Valkey instance, the data is kept.
+func Stop() error {
+	err := internal.StopContainerIfExists(instanceName)
+	if err != nil {
+		return fmt.Errorf("stop redis: %w", err)
+	}
+
+	return nil
+}
+
+// ping sends a PING command and checks for a PONG reply.
+func ping(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	_, err = conn.Write([]byte("PING\r\n"))
+	if err != nil {
+		return fmt.Errorf("send ping: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read reply: %w", err)
+	}
+
+	if strings.TrimSpace(reply) != "+PONG" {
+		return errors.New("unexpected reply: " + strings.TrimSpace(reply))
+	}
+
+	return nil
+}
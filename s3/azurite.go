@@ -0,0 +1,217 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	azuriteImage    = "mcr.microsoft.com/azure-storage/azurite:3.34.0"
+	azuriteInstance = "local-azurite"
+	azuriteEndpoint = "http://localhost:10000"
+	azuriteAPI      = "2021-12-02"
+
+	// AzuriteAccount and AzuriteKey are the well known development
+	// credentials of Azurite.
+	AzuriteAccount = "devstoreaccount1"
+	AzuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// azuriteBackend runs the blob service of Azurite, the Azure Storage
+// emulator. Containers are used as buckets.
+type azuriteBackend struct{}
+
+func (azuriteBackend) Name() string {
+	return "azure"
+}
+
+func (azuriteBackend) Instance() string {
+	return azuriteInstance
+}
+
+func (b azuriteBackend) Start(ctx context.Context) error {
+	return startEmulator(ctx, b, azuriteImage,
+		[]string{"10000:10000"}, "/data",
+		"azurite-blob",
+		"--blobHost", "0.0.0.0",
+		"--blobPort", "10000",
+		"--location", "/data",
+		"--skipApiVersionCheck",
+	)
+}
+
+func (azuriteBackend) Ready(ctx context.Context) error {
+	return azuriteRequest(ctx, http.MethodGet, "",
+		url.Values{"comp": {"list"}}, nil, 0, nil, nil)
+}
+
+func (azuriteBackend) CreateBucket(ctx context.Context, name string) error {
+	err := azuriteRequest(ctx, http.MethodPut, name,
+		url.Values{"restype": {"container"}}, nil, 0, nil,
+		[]int{http.StatusConflict})
+	if err != nil {
+		return fmt.Errorf("create container: %w", err)
+	}
+
+	return nil
+}
+
+func (azuriteBackend) PutObject(
+	ctx context.Context, bucket string, key string,
+	body io.Reader, size int64, meta ObjectMeta,
+) error {
+	header := http.Header{
+		"X-Ms-Blob-Type": {"BlockBlob"},
+		"Content-Type":   {meta.ContentType},
+	}
+
+	optional := map[string]string{
+		"X-Ms-Blob-Content-Encoding":    meta.ContentEncoding,
+		"X-Ms-Blob-Content-Disposition": meta.ContentDisposition,
+		"X-Ms-Blob-Cache-Control":       meta.CacheControl,
+	}
+
+	for k, v := range optional {
+		if v != "" {
+			header.Set(k, v)
+		}
+	}
+
+	for k, v := range meta.Metadata {
+		header.Set("X-Ms-Meta-"+k, v)
+	}
+
+	if len(meta.Tags) > 0 {
+		tags := make(url.Values)
+
+		for k, v := range meta.Tags {
+			tags.Set(k, v)
+		}
+
+		header.Set("X-Ms-Tags", tags.Encode())
+	}
+
+	err := azuriteRequest(ctx, http.MethodPut, bucket+"/"+key,
+		nil, body, size, header, nil)
+	if err != nil {
+		return fmt.Errorf("upload blob: %w", err)
+	}
+
+	return nil
+}
+
+// azuriteRequest sends a request signed with the development account key to
+// the blob service.
+func azuriteRequest(
+	ctx context.Context, method string, path string, query url.Values,
+	body io.Reader, size int64, header http.Header, accepted []int,
+) error {
+	u := azuriteEndpoint + "/" + AzuriteAccount
+
+	if path != "" {
+		u += "/" + (&url.URL{Path: path}).EscapedPath()
+	}
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	req.ContentLength = size
+
+	req.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azuriteAPI)
+
+	signature, err := sharedKeySignature(req, query)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization",
+		"SharedKey "+AzuriteAccount+":"+signature)
+
+	return doRequest(req, accepted)
+}
+
+// sharedKeySignature signs a request with the Shared Key scheme of the Azure
+// Storage services.
+func sharedKeySignature(req *http.Request, query url.Values) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(AzuriteKey)
+	if err != nil {
+		return "", fmt.Errorf("decode account key: %w", err)
+	}
+
+	var length string
+
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-ms-") {
+			msHeaders = append(msHeaders, lk+":"+req.Header.Get(k))
+		}
+	}
+
+	slices.Sort(msHeaders)
+
+	// The emulator uses path style URLs, so the account name is repeated
+	// in the canonicalized resource.
+	resource := "/" + AzuriteAccount + req.URL.EscapedPath()
+
+	params := make([]string, 0, len(query))
+
+	for k, v := range query {
+		params = append(params, strings.ToLower(k)+":"+strings.Join(v, ","))
+	}
+
+	slices.Sort(params)
+
+	for _, p := range params {
+		resource += "\n" + p
+	}
+
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-Md5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead.
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+		resource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+
+	_, _ = mac.Write([]byte(toSign))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,149 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ttab/mage/internal"
+)
+
+// Backend is a local object storage emulator.
+type Backend interface {
+	// Name is used to select the backend with S3_BACKEND.
+	Name() string
+	// Instance is the name of the emulator container and of its data
+	// directory in the state directory, Destroy refuses to delete
+	// directories outside of the state directory.
+	Instance() string
+	// Start starts the emulator and waits for it to become ready.
+	Start(ctx context.Context) error
+	// Ready returns nil when the emulator accepts requests.
+	Ready(ctx context.Context) error
+	// CreateBucket creates a bucket if it doesn't exist.
+	CreateBucket(ctx context.Context, name string) error
+	// PutObject uploads an object with the headers, metadata, and tags
+	// in meta. Backends that can't store a part of meta return an error.
+	PutObject(
+		ctx context.Context, bucket string, key string,
+		body io.Reader, size int64, meta ObjectMeta,
+	) error
+}
+
+// DirSeeder is implemented by backends that can seed a bucket from a
+// directory more efficiently than by uploading every file, f.ex. by skipping
+// objects that haven't changed.
+type DirSeeder interface {
+	SeedDir(ctx context.Context, bucket string, dir string) error
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]Backend{
+		"minio": minioBackend{},
+		"gcs":   gcsBackend{},
+		"azure": azuriteBackend{},
+	}
+)
+
+// RegisterBackend makes a backend available to the s3 targets, replacing any
+// backend with the same name.
+func RegisterBackend(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	backends[b.Name()] = b
+}
+
+// GetBackend returns the named backend.
+func GetBackend(name string) (Backend, error) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	b, ok := backends[name]
+	if !ok {
+		names := make([]string, 0, len(backends))
+
+		for n := range backends {
+			names = append(names, n)
+		}
+
+		slices.Sort(names)
+
+		return nil, fmt.Errorf("unknown backend %q, available backends: %v",
+			name, names)
+	}
+
+	return b, nil
+}
+
+// backendFromEnv returns the backend selected by S3_BACKEND, defaulting to
+// minio.
+func backendFromEnv() (Backend, error) {
+	name := os.Getenv("S3_BACKEND")
+	if name == "" {
+		name = "minio"
+	}
+
+	return GetBackend(name)
+}
+
+// Start starts the named local object storage emulator: "minio", "gcs"
+// (fake-gcs-server), or "azure" (Azurite).
+func Start(ctx context.Context, backend string) error {
+	b, err := GetBackend(backend)
+	if err != nil {
+		return err
+	}
+
+	return b.Start(ctx)
+}
+
+// waitForBackend waits for a backend to become ready.
+func waitForBackend(ctx context.Context, b Backend) error {
+	return internal.WaitFor(ctx, b.Name(), 20*time.Second, b.Ready)
+}
+
+// startEmulator starts an emulator container with its data directory in the
+// state directory mounted at dataPath.
+func startEmulator(
+	ctx context.Context, b Backend, image string,
+	ports []string, dataPath string, command ...string,
+) error {
+	name := b.Instance()
+
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return fmt.Errorf("get state directory path: %w", err)
+	}
+
+	dataDir := filepath.Join(stateDir, name)
+
+	err = os.MkdirAll(dataDir, 0o700)
+	if err != nil {
+		return fmt.Errorf("create local state directory: %w", err)
+	}
+
+	err = internal.RunContainer(internal.ContainerOptions{
+		Name:     name,
+		Service:  b.Name(),
+		Image:    image,
+		StateDir: dataDir,
+		Ports:    ports,
+		Args: []string{
+			"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			"-v", fmt.Sprintf("%s:%s", dataDir, dataPath),
+		},
+		Command: command,
+	})
+	if err != nil {
+		return err
+	}
+
+	return waitForBackend(ctx, b)
+}
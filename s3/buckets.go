@@ -0,0 +1,370 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/cors"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/notification"
+)
+
+// BucketSpec declares the buckets of a project.
+type BucketSpec struct {
+	Buckets []BucketConfig `json:"buckets"`
+}
+
+// BucketConfig declares a bucket and its configuration.
+type BucketConfig struct {
+	Name       string `json:"name"`
+	Versioning bool   `json:"versioning,omitempty"`
+	// ObjectLocking can only be enabled when the bucket is created, and
+	// implies versioning.
+	ObjectLocking bool             `json:"object_locking,omitempty"`
+	Retention     *BucketRetention `json:"retention,omitempty"`
+	// AnonymousRead lists key prefixes that can be read without
+	// credentials, use "" for the whole bucket.
+	AnonymousRead []string `json:"anonymous_read,omitempty"`
+	// Policy is a bucket policy document, it can't be combined with
+	// AnonymousRead.
+	Policy        json.RawMessage      `json:"policy,omitempty"`
+	Lifecycle     []LifecycleRule      `json:"lifecycle,omitempty"`
+	CORS          []CORSRule           `json:"cors,omitempty"`
+	Notifications []BucketNotification `json:"notifications,omitempty"`
+}
+
+// BucketRetention is the default retention for objects in a bucket with
+// object locking.
+type BucketRetention struct {
+	// Mode is "GOVERNANCE" or "COMPLIANCE".
+	Mode  string `json:"mode"`
+	Days  uint   `json:"days,omitempty"`
+	Years uint   `json:"years,omitempty"`
+}
+
+// LifecycleRule expires objects under a prefix.
+type LifecycleRule struct {
+	ID     string `json:"id"`
+	Prefix string `json:"prefix,omitempty"`
+	// ExpireDays expires current object versions.
+	ExpireDays int `json:"expire_days,omitempty"`
+	// NoncurrentExpireDays expires noncurrent object versions.
+	NoncurrentExpireDays int `json:"noncurrent_expire_days,omitempty"`
+	// AbortIncompleteDays aborts incomplete multipart uploads.
+	AbortIncompleteDays int `json:"abort_incomplete_days,omitempty"`
+}
+
+// CORSRule allows cross-origin requests to a bucket.
+type CORSRule struct {
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+	ExposeHeaders  []string `json:"expose_headers,omitempty"`
+	MaxAgeSeconds  int      `json:"max_age_seconds,omitempty"`
+}
+
+// BucketNotification sends bucket events to a notification target. The
+// target must be configured on the server, see MinioConfig.Env.
+type BucketNotification struct {
+	// ARN of the target, f.ex. "arn:minio:sqs::primary:webhook".
+	ARN string `json:"arn"`
+	// Events, f.ex. "s3:ObjectCreated:*".
+	Events []string `json:"events"`
+	Prefix string   `json:"prefix,omitempty"`
+	Suffix string   `json:"suffix,omitempty"`
+}
+
+// Buckets creates the buckets declared in "./minio/buckets.json" in the local
+// minio instance and applies their configuration. Configuration that isn't
+// declared, f.ex. a lifecycle rule that has been removed from the file, is
+// removed from the bucket.
+func Buckets(ctx context.Context) error {
+	spec, err := ReadBucketSpec(filepath.Join("minio", "buckets.json"))
+	if err != nil {
+		return err
+	}
+
+	return ProvisionBuckets(ctx, spec)
+}
+
+// ReadBucketSpec reads a bucket spec file.
+func ReadBucketSpec(name string) (BucketSpec, error) {
+	var spec BucketSpec
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return spec, fmt.Errorf("read bucket spec: %w", err)
+	}
+
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		return spec, fmt.Errorf("unmarshal bucket spec: %w", err)
+	}
+
+	return spec, nil
+}
+
+// ProvisionBuckets creates the buckets in the spec in the local minio instance
+// and applies their configuration.
+func ProvisionBuckets(ctx context.Context, spec BucketSpec) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range spec.Buckets {
+		err := provisionBucket(ctx, client, b)
+		if err != nil {
+			return fmt.Errorf("provision bucket %q: %w", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func provisionBucket(
+	ctx context.Context, client *minio.Client, b BucketConfig,
+) error {
+	if b.Retention != nil && !b.ObjectLocking {
+		return errors.New("retention requires object locking")
+	}
+
+	if len(b.Policy) > 0 && len(b.AnonymousRead) > 0 {
+		return errors.New("policy and anonymous_read can't be combined")
+	}
+
+	exists, err := client.BucketExists(ctx, b.Name)
+	if err != nil {
+		return fmt.Errorf("check if bucket exists: %w", err)
+	}
+
+	if !exists {
+		err := client.MakeBucket(ctx, b.Name, minio.MakeBucketOptions{
+			ObjectLocking: b.ObjectLocking,
+		})
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+	}
+
+	if exists && b.ObjectLocking {
+		_, _, _, err := client.GetBucketObjectLockConfig(ctx, b.Name)
+		if err != nil {
+			return fmt.Errorf(
+				"object locking can only be enabled when the bucket is created: %w",
+				err)
+		}
+	}
+
+	switch {
+	case b.Versioning || b.ObjectLocking:
+		err = client.EnableVersioning(ctx, b.Name)
+	case exists:
+		var v minio.BucketVersioningConfiguration
+
+		v, err = client.GetBucketVersioning(ctx, b.Name)
+		if err == nil && v.Enabled() {
+			err = client.SuspendVersioning(ctx, b.Name)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("set versioning: %w", err)
+	}
+
+	switch {
+	case b.Retention != nil:
+		err = setRetention(ctx, client, b.Name, *b.Retention)
+		if err != nil {
+			return err
+		}
+	case b.ObjectLocking:
+		// Clear any default retention that has been removed from the
+		// spec.
+		err = client.SetBucketObjectLockConfig(ctx, b.Name, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("clear retention: %w", err)
+		}
+	}
+
+	policy, err := bucketPolicy(b)
+	if err != nil {
+		return err
+	}
+
+	err = client.SetBucketPolicy(ctx, b.Name, policy)
+	if err != nil {
+		return fmt.Errorf("set policy: %w", err)
+	}
+
+	err = client.SetBucketLifecycle(ctx, b.Name, lifecycleConfig(b.Lifecycle))
+	if err != nil {
+		return fmt.Errorf("set lifecycle: %w", err)
+	}
+
+	err = client.SetBucketCors(ctx, b.Name, corsConfig(b.CORS))
+	if err != nil {
+		return fmt.Errorf("set CORS: %w", err)
+	}
+
+	notifications, err := notificationConfig(b.Notifications)
+	if err != nil {
+		return err
+	}
+
+	err = client.SetBucketNotification(ctx, b.Name, notifications)
+	if err != nil {
+		return fmt.Errorf("set notifications: %w", err)
+	}
+
+	return nil
+}
+
+func setRetention(
+	ctx context.Context, client *minio.Client, bucket string, r BucketRetention,
+) error {
+	mode := minio.RetentionMode(strings.ToUpper(r.Mode))
+	if !mode.IsValid() {
+		return fmt.Errorf("invalid retention mode %q", r.Mode)
+	}
+
+	validity, unit := r.Days, minio.Days
+
+	switch {
+	case r.Days > 0 && r.Years > 0:
+		return errors.New("retention must be given in either days or years")
+	case r.Years > 0:
+		validity, unit = r.Years, minio.Years
+	case r.Days == 0:
+		return errors.New("retention must have a validity")
+	}
+
+	err := client.SetBucketObjectLockConfig(ctx, bucket, &mode, &validity, &unit)
+	if err != nil {
+		return fmt.Errorf("set retention: %w", err)
+	}
+
+	return nil
+}
+
+// bucketPolicy returns the policy document for the bucket, an empty string
+// removes the bucket policy.
+func bucketPolicy(b BucketConfig) (string, error) {
+	if len(b.Policy) > 0 {
+		return string(b.Policy), nil
+	}
+
+	if len(b.AnonymousRead) == 0 {
+		return "", nil
+	}
+
+	resources := make([]string, len(b.AnonymousRead))
+
+	for i, prefix := range b.AnonymousRead {
+		resources[i] = fmt.Sprintf("arn:aws:s3:::%s/%s*", b.Name, prefix)
+	}
+
+	policy := map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Effect":    "Allow",
+				"Principal": map[string]any{"AWS": []string{"*"}},
+				"Action":    []string{"s3:GetObject"},
+				"Resource":  resources,
+			},
+		},
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", fmt.Errorf("marshal policy: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func lifecycleConfig(rules []LifecycleRule) *lifecycle.Configuration {
+	cfg := lifecycle.NewConfiguration()
+
+	for _, r := range rules {
+		rule := lifecycle.Rule{
+			ID:         r.ID,
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: r.Prefix},
+		}
+
+		rule.Expiration.Days = lifecycle.ExpirationDays(r.ExpireDays)
+		rule.NoncurrentVersionExpiration.NoncurrentDays =
+			lifecycle.ExpirationDays(r.NoncurrentExpireDays)
+		rule.AbortIncompleteMultipartUpload.DaysAfterInitiation =
+			lifecycle.ExpirationDays(r.AbortIncompleteDays)
+
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+
+	return cfg
+}
+
+// corsConfig returns the CORS configuration for the bucket, nil removes the
+// configuration.
+func corsConfig(rules []CORSRule) *cors.Config {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	cr := make([]cors.Rule, len(rules))
+
+	for i, r := range rules {
+		cr[i] = cors.Rule{
+			AllowedOrigin: r.AllowedOrigins,
+			AllowedMethod: r.AllowedMethods,
+			AllowedHeader: r.AllowedHeaders,
+			ExposeHeader:  r.ExposeHeaders,
+			MaxAgeSeconds: r.MaxAgeSeconds,
+		}
+	}
+
+	return cors.NewConfig(cr)
+}
+
+func notificationConfig(
+	notifications []BucketNotification,
+) (notification.Configuration, error) {
+	var cfg notification.Configuration
+
+	for _, n := range notifications {
+		arn, err := notification.NewArnFromString(n.ARN)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid notification ARN %q: %w",
+				n.ARN, err)
+		}
+
+		c := notification.NewConfig(arn)
+
+		for _, e := range n.Events {
+			c.AddEvents(notification.EventType(e))
+		}
+
+		if n.Prefix != "" {
+			c.AddFilterPrefix(n.Prefix)
+		}
+
+		if n.Suffix != "" {
+			c.AddFilterSuffix(n.Suffix)
+		}
+
+		if !cfg.AddQueue(c) {
+			return cfg, fmt.Errorf(
+				"overlapping events for the notification target %q", n.ARN)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ttab/mage/internal"
+)
+
+// MinioConfig is the configuration of the local minio instance. It's stored
+// next to the data directory in the state directory when the instance is
+// created, so that other targets know how to connect to it.
+type MinioConfig struct {
+	Image       string `json:"image"`
+	Port        int    `json:"port"`
+	ConsolePort int    `json:"console_port"`
+	AccessKey   string `json:"access_key"`
+	SecretKey   string `json:"secret_key"`
+	// Env are additional environment variables for the server, f.ex. to
+	// configure notification targets.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// DefaultMinioConfig returns the default minio configuration.
+func DefaultMinioConfig() MinioConfig {
+	return MinioConfig{
+		Image:       minioImage,
+		Port:        9000,
+		ConsolePort: 9001,
+		AccessKey:   "minioadmin",
+		SecretKey:   "minioadmin",
+	}
+}
+
+// Endpoint returns the host and port of the S3 API.
+func (c MinioConfig) Endpoint() string {
+	return fmt.Sprintf("localhost:%d", c.Port)
+}
+
+// LoadMinioConfig reads the configuration of the local minio instance,
+// falling back to the defaults if the instance hasn't been created.
+func LoadMinioConfig() (MinioConfig, error) {
+	cfg := DefaultMinioConfig()
+
+	name, err := minioConfigFile()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("read minio config: %w", err)
+	}
+
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("unmarshal minio config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func saveMinioConfig(cfg MinioConfig) error {
+	name, err := minioConfigFile()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal minio config: %w", err)
+	}
+
+	err = os.WriteFile(name, append(data, '\n'), 0o600)
+	if err != nil {
+		return fmt.Errorf("write minio config: %w", err)
+	}
+
+	return nil
+}
+
+func minioConfigFile() (string, error) {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return "", fmt.Errorf("get state directory path: %w", err)
+	}
+
+	return filepath.Join(stateDir, instanceName+".json"), nil
+}
+
+// applyMinioEnv overrides the configuration with the MINIO_* environment
+// variables.
+func applyMinioEnv(cfg *MinioConfig) error {
+	if v := os.Getenv("MINIO_IMAGE"); v != "" {
+		cfg.Image = v
+	}
+
+	if v := os.Getenv("MINIO_ACCESS_KEY"); v != "" {
+		cfg.AccessKey = v
+	}
+
+	if v := os.Getenv("MINIO_SECRET_KEY"); v != "" {
+		cfg.SecretKey = v
+	}
+
+	ports := map[string]*int{
+		"MINIO_PORT":         &cfg.Port,
+		"MINIO_CONSOLE_PORT": &cfg.ConsolePort,
+	}
+
+	for name, port := range ports {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port in %s: %q", name, v)
+		}
+
+		*port = n
+	}
+
+	if len(cfg.SecretKey) < 8 {
+		return errors.New("the minio secret key must be at least 8 characters")
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+const (
+	gcsImage    = "fsouza/fake-gcs-server:1.52.2"
+	gcsInstance = "local-fake-gcs"
+	gcsEndpoint = "http://localhost:4443"
+)
+
+// gcsBackend runs fake-gcs-server, an emulator for the Google Cloud Storage
+// JSON API. Point the storage client to it with
+// STORAGE_EMULATOR_HOST=localhost:4443.
+type gcsBackend struct{}
+
+func (gcsBackend) Name() string {
+	return "gcs"
+}
+
+func (gcsBackend) Instance() string {
+	return gcsInstance
+}
+
+func (b gcsBackend) Start(ctx context.Context) error {
+	return startEmulator(ctx, b, gcsImage,
+		[]string{"4443:4443"}, "/storage",
+		"-scheme", "http",
+		"-port", "4443",
+		"-backend", "filesystem",
+		"-filesystem-root", "/storage",
+		"-public-host", "localhost:4443",
+		"-external-url", gcsEndpoint,
+	)
+}
+
+func (gcsBackend) Ready(ctx context.Context) error {
+	return gcsRequest(ctx, http.MethodGet, "/storage/v1/b", nil, "", nil)
+}
+
+func (gcsBackend) CreateBucket(ctx context.Context, name string) error {
+	body, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return fmt.Errorf("marshal bucket: %w", err)
+	}
+
+	err = gcsRequest(ctx, http.MethodPost, "/storage/v1/b?project=local",
+		bytes.NewReader(body), "application/json",
+		[]int{http.StatusConflict})
+	if err != nil {
+		return fmt.Errorf("create bucket: %w", err)
+	}
+
+	return nil
+}
+
+// PutObject uploads the object and its metadata as a multipart upload. Cloud
+// Storage doesn't have object tags, so objects with tags are rejected.
+func (gcsBackend) PutObject(
+	ctx context.Context, bucket string, key string,
+	body io.Reader, _ int64, meta ObjectMeta,
+) error {
+	if len(meta.Tags) > 0 {
+		return errors.New("object tags aren't supported by gcs")
+	}
+
+	metadata, err := json.Marshal(map[string]any{
+		"name":               key,
+		"contentType":        meta.ContentType,
+		"contentEncoding":    meta.ContentEncoding,
+		"contentDisposition": meta.ContentDisposition,
+		"cacheControl":       meta.CacheControl,
+		"metadata":           meta.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal object metadata: %w", err)
+	}
+
+	var head bytes.Buffer
+
+	mw := multipart.NewWriter(&head)
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"application/json; charset=UTF-8"},
+	})
+	if err != nil {
+		return fmt.Errorf("create metadata part: %w", err)
+	}
+
+	_, err = part.Write(metadata)
+	if err != nil {
+		return fmt.Errorf("write metadata part: %w", err)
+	}
+
+	_, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {meta.ContentType},
+	})
+	if err != nil {
+		return fmt.Errorf("create media part: %w", err)
+	}
+
+	// The media part is streamed from the body, followed by the closing
+	// boundary.
+	multipartBody := io.MultiReader(&head, body,
+		strings.NewReader("\r\n--"+mw.Boundary()+"--\r\n"))
+
+	path := fmt.Sprintf("/upload/storage/v1/b/%s/o?uploadType=multipart",
+		url.PathEscape(bucket))
+
+	err = gcsRequest(ctx, http.MethodPost, path, multipartBody,
+		"multipart/related; boundary="+mw.Boundary(), nil)
+	if err != nil {
+		return fmt.Errorf("upload object: %w", err)
+	}
+
+	return nil
+}
+
+// gcsRequest sends a request to fake-gcs-server, the accepted status codes
+// are treated as success in addition to 2xx.
+func gcsRequest(
+	ctx context.Context, method string, path string,
+	body io.Reader, contentType string, accepted []int,
+) error {
+	req, err := http.NewRequestWithContext(ctx, method, gcsEndpoint+path, body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return doRequest(req, accepted)
+}
+
+// doRequest performs a request and returns an error with the response body
+// for unexpected status codes.
+func doRequest(req *http.Request, accepted []int) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("perform request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	for _, code := range accepted {
+		if res.StatusCode == code {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path,
+		res.Status, bytes.TrimSpace(msg))
+}
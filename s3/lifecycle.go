@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ttab/mage/ia"
+	"github.com/ttab/mage/internal"
+)
+
+const instanceName = "local-minio"
+
+// stateCleaner is implemented by backends that keep state outside of their
+// data directory.
+type stateCleaner interface {
+	CleanState() error
+}
+
+// Stop stops the local object storage emulator selected by S3_BACKEND, the
+// data is kept and the emulator can be started again.
+func Stop() error {
+	backend, err := backendFromEnv()
+	if err != nil {
+		return err
+	}
+
+	err = internal.StopContainerIfExists(backend.Instance())
+	if err != nil {
+		return fmt.Errorf("stop %s: %w", backend.Name(), err)
+	}
+
+	return nil
+}
+
+// Logs follows the logs of the local object storage emulator selected by
+// S3_BACKEND.
+func Logs() error {
+	backend, err := backendFromEnv()
+	if err != nil {
+		return err
+	}
+
+	return internal.ContainerLogs(backend.Instance())
+}
+
+// Destroy stops the local object storage emulator selected by S3_BACKEND and
+// deletes its data after confirmation.
+func Destroy() error {
+	backend, err := backendFromEnv()
+	if err != nil {
+		return err
+	}
+
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return fmt.Errorf("get state directory path: %w", err)
+	}
+
+	instance := backend.Instance()
+	dataDir := filepath.Join(stateDir, instance)
+
+	rel, err := filepath.Rel(stateDir, dataDir)
+	if err != nil || instance == "" || rel != instance ||
+		rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("data directory %q for the %s backend is outside of %q",
+			dataDir, backend.Name(), stateDir)
+	}
+
+	ok, err := ia.Confirm(fmt.Sprintf(
+		"Delete the %s instance, its configuration, and all data in %s",
+		backend.Name(), dataDir))
+	if err != nil {
+		return fmt.Errorf("confirm deletion: %w", err)
+	}
+
+	if !ok {
+		return errors.New("aborted")
+	}
+
+	err = internal.StopContainerIfExists(backend.Instance())
+	if err != nil {
+		return fmt.Errorf("stop %s: %w", backend.Name(), err)
+	}
+
+	err = os.RemoveAll(dataDir)
+	if err != nil {
+		return fmt.Errorf("remove data directory: %w", err)
+	}
+
+	if cleaner, ok := backend.(stateCleaner); ok {
+		return cleaner.CleanState()
+	}
+
+	return nil
+}
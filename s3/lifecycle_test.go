@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeBackend is a backend that only has a name and an instance.
+type fakeBackend struct {
+	Backend
+
+	name     string
+	instance string
+}
+
+func (b fakeBackend) Name() string {
+	return b.name
+}
+
+func (b fakeBackend) Instance() string {
+	return b.instance
+}
+
+func TestDestroyOutsideStateDir(t *testing.T) {
+	t.Setenv("STATE_DIR", t.TempDir())
+
+	for _, instance := range []string{
+		"", ".", "..", "../x", "./x", "a/../../x", "/etc",
+	} {
+		t.Run(instance, func(t *testing.T) {
+			RegisterBackend(fakeBackend{name: "fake", instance: instance})
+
+			t.Cleanup(func() {
+				backendsMu.Lock()
+				defer backendsMu.Unlock()
+
+				delete(backends, "fake")
+			})
+
+			t.Setenv("S3_BACKEND", "fake")
+
+			err := Destroy()
+			if err == nil || !strings.Contains(err.Error(), "is outside of") {
+				t.Fatalf("expected an outside of state directory error, got %v",
+					err)
+			}
+		})
+	}
+}
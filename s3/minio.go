@@ -2,12 +2,13 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
-	"time"
 
-	"github.com/magefile/mage/sh"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/ttab/mage/internal"
@@ -15,8 +16,27 @@ import (
 
 const minioImage = "minio/minio:RELEASE.2024-03-05T04-48-44Z"
 
-// Minio creates a local minio instance using docker.
+// Minio creates a local minio instance using docker. The configuration of
+// an existing instance is reused, and can be changed with the MINIO_PORT,
+// MINIO_CONSOLE_PORT, MINIO_ACCESS_KEY, MINIO_SECRET_KEY, and MINIO_IMAGE
+// environment variables.
 func Minio() error {
+	cfg, err := LoadMinioConfig()
+	if err != nil {
+		return err
+	}
+
+	err = applyMinioEnv(&cfg)
+	if err != nil {
+		return err
+	}
+
+	return MinioWithConfig(cfg)
+}
+
+// MinioWithConfig creates a local minio instance with the given
+// configuration, and saves the configuration for use by the other targets.
+func MinioWithConfig(cfg MinioConfig) error {
 	uid := os.Getuid()
 	gid := os.Getgid()
 
@@ -25,7 +45,6 @@ func Minio() error {
 		return fmt.Errorf("get state directory path: %w", err)
 	}
 
-	instanceName := "local-minio"
 	dataDir := filepath.Join(stateDir, instanceName)
 
 	err = os.MkdirAll(dataDir, 0o700)
@@ -33,57 +52,91 @@ func Minio() error {
 		return fmt.Errorf("create local state directory: %w", err)
 	}
 
-	err = internal.StopContainerIfExists(instanceName)
+	env := maps.Clone(cfg.Env)
+	if env == nil {
+		env = make(map[string]string)
+	}
+
+	env["MINIO_ROOT_USER"] = cfg.AccessKey
+	env["MINIO_ROOT_PASSWORD"] = cfg.SecretKey
+
+	err = internal.RunContainer(internal.ContainerOptions{
+		Name:     instanceName,
+		Service:  "minio",
+		Image:    cfg.Image,
+		StateDir: dataDir,
+		Ports: []string{
+			fmt.Sprintf("%d:9000", cfg.Port),
+			fmt.Sprintf("%d:9001", cfg.ConsolePort),
+		},
+		Env: env,
+		Args: []string{
+			"--user", fmt.Sprintf("%d:%d", uid, gid),
+			"-v", fmt.Sprintf("%s:/data", dataDir),
+		},
+		Command: []string{
+			"server", "/data",
+			"--console-address", ":9001",
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("stop existing container: %w", err)
+		return err
 	}
 
-	err = sh.Run("docker", "run", "-d", "--rm",
-		"--name", instanceName,
-		"--user", fmt.Sprintf("%d:%d", uid, gid),
-		"-v", fmt.Sprintf("%s:/data", dataDir),
-		"-p", "9000:9000",
-		"-p", "9001:9001",
-		minioImage,
-		"server", "/data",
-		"--console-address", ":9001",
-	)
+	err = saveMinioConfig(cfg)
 	if err != nil {
-		return fmt.Errorf("start postgres: %w", err)
+		return err
 	}
 
-	client, err := minioClient()
+	return waitForBackend(context.Background(), minioBackend{})
+}
+
+// Bucket creates a bucket in the local object storage emulator selected by
+// S3_BACKEND, defaulting to minio.
+func Bucket(name string) error {
+	backend, err := backendFromEnv()
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
+	return backend.CreateBucket(context.Background(), name)
+}
+
+// minioBackend is the default backend.
+type minioBackend struct{}
+
+func (minioBackend) Name() string {
+	return "minio"
+}
 
-	deadline := time.Now().Add(20 * time.Second)
-	for {
-		_, err := client.BucketExists(ctx, "randomname")
-		if err != nil && time.Now().After(deadline) {
-			return fmt.Errorf("failed to ensure that minio is available: %w", err)
-		} else if err != nil {
-			time.Sleep(300 * time.Millisecond)
-			continue
-		}
+func (minioBackend) Instance() string {
+	return instanceName
+}
 
-		break
+func (minioBackend) Start(_ context.Context) error {
+	return Minio()
+}
+
+func (minioBackend) Ready(ctx context.Context) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.BucketExists(ctx, "randomname")
+	if err != nil {
+		return fmt.Errorf("check bucket: %w", err)
 	}
 
 	return nil
 }
 
-// Bucket creates a bucket in the local minio instance.
-func Bucket(name string) error {
+func (minioBackend) CreateBucket(ctx context.Context, name string) error {
 	client, err := minioClient()
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
-
 	exists, err := client.BucketExists(ctx, name)
 	if err != nil {
 		return fmt.Errorf("check if bucket exists: %w", err)
@@ -102,15 +155,59 @@ func Bucket(name string) error {
 	return nil
 }
 
+func (minioBackend) PutObject(
+	ctx context.Context, bucket string, key string,
+	body io.Reader, size int64, meta ObjectMeta,
+) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObject(ctx, bucket, key, body, size,
+		meta.putOptions())
+	if err != nil {
+		return fmt.Errorf("upload object: %w", err)
+	}
+
+	return nil
+}
+
+// SeedDir syncs the directory to the bucket, skipping unchanged objects.
+func (minioBackend) SeedDir(
+	ctx context.Context, bucket string, dir string,
+) error {
+	return Sync(ctx, dir, "s3://"+bucket)
+}
+
+// CleanState removes the saved minio configuration.
+func (minioBackend) CleanState() error {
+	configFile, err := minioConfigFile()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(configFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove minio config: %w", err)
+	}
+
+	return nil
+}
+
 func minioClient() (*minio.Client, error) {
-	endpoint := "localhost:9000"
-	accessKeyID := "minioadmin"
-	secretAccessKey := "minioadmin"
-	useSSL := false
-
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
+	cfg, err := LoadMinioConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return clientFromConfig(cfg)
+}
+
+func clientFromConfig(cfg MinioConfig) (*minio.Client, error) {
+	client, err := minio.New(cfg.Endpoint(), &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: false,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create minio client: %w", err)
@@ -0,0 +1,240 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/ttab/mage/ia"
+	"github.com/ttab/mage/internal"
+)
+
+// ListBuckets lists the buckets in the local minio instance.
+func ListBuckets(ctx context.Context) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	buckets, err := client.ListBuckets(ctx)
+	if err != nil {
+		return fmt.Errorf("list buckets: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "BUCKET\tCREATED")
+
+	for _, b := range buckets {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n",
+			b.Name, b.CreationDate.Format("2006-01-02 15:04:05"))
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("write bucket list: %w", err)
+	}
+
+	return nil
+}
+
+// Objects lists the objects in a bucket that have the given key prefix, and
+// the total number of objects and their size. Use an empty prefix to list all
+// objects.
+func Objects(ctx context.Context, bucket string, prefix string) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "KEY\tSIZE\tMODIFIED")
+
+	var (
+		count int
+		total int64
+	)
+
+	objects := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for obj := range objects {
+		if obj.Err != nil {
+			return fmt.Errorf("list objects: %w", obj.Err)
+		}
+
+		count++
+		total += obj.Size
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n",
+			obj.Key, internal.FormatBytes(obj.Size),
+			obj.LastModified.Format("2006-01-02 15:04:05"))
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("write object list: %w", err)
+	}
+
+	fmt.Printf("\n%d objects, %s\n", count, internal.FormatBytes(total))
+
+	return nil
+}
+
+// Cat writes the contents of an object to stdout.
+func Cat(ctx context.Context, bucket string, key string) error {
+	return getObject(ctx, bucket, key, os.Stdout)
+}
+
+// Download writes the contents of an object to a file.
+func Download(ctx context.Context, bucket string, key string, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	err = getObject(ctx, bucket, key, f)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(file)
+
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+
+	return nil
+}
+
+func getObject(ctx context.Context, bucket string, key string, w io.Writer) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("get object: %w", err)
+	}
+
+	defer obj.Close()
+
+	_, err = io.Copy(w, obj)
+	if err != nil {
+		return fmt.Errorf("read object: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePrefix deletes all objects in a bucket that have the given key prefix
+// after confirmation. Use an empty prefix to delete all objects.
+func DeletePrefix(ctx context.Context, bucket string, prefix string) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	var keys []minio.ObjectInfo
+
+	objects := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for obj := range objects {
+		if obj.Err != nil {
+			return fmt.Errorf("list objects: %w", obj.Err)
+		}
+
+		keys = append(keys, obj)
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No objects to delete.")
+
+		return nil
+	}
+
+	ok, err := ia.Confirm(fmt.Sprintf(
+		"Delete %d objects with the prefix %q from %q",
+		len(keys), prefix, bucket))
+	if err != nil {
+		return fmt.Errorf("confirm deletion: %w", err)
+	}
+
+	if !ok {
+		return errors.New("aborted")
+	}
+
+	toDelete := make(chan minio.ObjectInfo)
+
+	go func() {
+		defer close(toDelete)
+
+		for _, obj := range keys {
+			toDelete <- obj
+		}
+	}()
+
+	var failed []string
+
+	for rErr := range client.RemoveObjects(ctx, bucket, toDelete,
+		minio.RemoveObjectsOptions{}) {
+		failed = append(failed,
+			fmt.Sprintf("%s: %v", rErr.ObjectName, rErr.Err))
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %d objects:\n%s",
+			len(failed), strings.Join(failed, "\n"))
+	}
+
+	fmt.Printf("Deleted %d objects\n", len(keys))
+
+	return nil
+}
+
+// Presign prints a presigned URL for an object. The method is "GET" or "PUT",
+// and expiry is a duration like "15m" or "24h".
+func Presign(
+	ctx context.Context, method string, bucket string, key string,
+	expiry time.Duration,
+) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	var u *url.URL
+
+	switch strings.ToUpper(method) {
+	case "GET":
+		u, err = client.PresignedGetObject(ctx, bucket, key, expiry, nil)
+	case "PUT":
+		u, err = client.PresignedPutObject(ctx, bucket, key, expiry)
+	default:
+		return fmt.Errorf("unsupported method %q, use GET or PUT", method)
+	}
+
+	if err != nil {
+		return fmt.Errorf("presign URL: %w", err)
+	}
+
+	fmt.Println(u.String())
+
+	return nil
+}
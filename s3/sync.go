@@ -0,0 +1,515 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// metaSuffix is the suffix of metadata sidecar files.
+const metaSuffix = ".meta.json"
+
+// checksumMeta is the user metadata key for the SHA-256 checksum of uploaded
+// objects.
+const checksumMeta = "Sha256"
+
+// metaChecksumMeta is the user metadata key for the SHA-256 checksum of the
+// metadata sidecar file of uploaded objects.
+const metaChecksumMeta = "Meta-Sha256"
+
+// ObjectMeta is the content of a metadata sidecar file, f.ex.
+// "report.pdf.meta.json" for "report.pdf".
+type ObjectMeta struct {
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+}
+
+// Seed uploads the files in the "./minio/seed" directory to the local object
+// storage emulator selected by S3_BACKEND. Every directory in "./minio/seed"
+// is named after the bucket that its contents are uploaded to, missing
+// buckets are created.
+func Seed(ctx context.Context) error {
+	backend, err := backendFromEnv()
+	if err != nil {
+		return err
+	}
+
+	return SeedBuckets(ctx, backend, filepath.Join("minio", "seed"))
+}
+
+// SeedBuckets uploads the files in a directory where every subdirectory is
+// named after the bucket that its contents are uploaded to.
+func SeedBuckets(ctx context.Context, backend Backend, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read seed directory: %w", err)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		err := SeedBucket(ctx, backend, e.Name(),
+			filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SeedFromDir uploads the files in a directory tree to a bucket in the local
+// object storage emulator selected by S3_BACKEND, creating the bucket if
+// necessary.
+func SeedFromDir(ctx context.Context, bucket string, dir string) error {
+	backend, err := backendFromEnv()
+	if err != nil {
+		return err
+	}
+
+	return SeedBucket(ctx, backend, bucket, dir)
+}
+
+// SeedBucket uploads the files in a directory tree to a bucket, creating the
+// bucket if necessary. Backends that implement DirSeeder, like minio, skip
+// objects that already have the same content.
+func SeedBucket(
+	ctx context.Context, backend Backend, bucket string, dir string,
+) error {
+	err := backend.CreateBucket(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	if seeder, ok := backend.(DirSeeder); ok {
+		return seeder.SeedDir(ctx, bucket, dir)
+	}
+
+	return uploadDir(ctx, backend, dir, bucket)
+}
+
+// uploadDir uploads all files in a directory tree using a backend.
+func uploadDir(
+	ctx context.Context, backend Backend, dir string, bucket string,
+) error {
+	var uploaded int
+
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasSuffix(name, metaSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return fmt.Errorf("get relative path: %w", err)
+		}
+
+		meta, err := readObjectMeta(name)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("open file: %w", err)
+		}
+
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("stat file: %w", err)
+		}
+
+		err = backend.PutObject(ctx, bucket, filepath.ToSlash(rel),
+			f, info.Size(), meta)
+		if err != nil {
+			return fmt.Errorf("upload %q: %w", rel, err)
+		}
+
+		uploaded++
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("upload %q to %q: %w", dir, bucket, err)
+	}
+
+	fmt.Printf("Uploaded %d objects to %q\n", uploaded, bucket)
+
+	return nil
+}
+
+// Sync mirrors objects between a directory and a bucket prefix in the local
+// minio instance. One of source and dest is a directory and the other an
+// "s3://bucket/prefix" URL. Only objects whose checksums differ are
+// transferred, and nothing is deleted from the destination.
+//
+// Uploads use the content type from metadata sidecar files (f.ex.
+// "report.pdf.meta.json"), or detect it from the file extension and contents.
+func Sync(ctx context.Context, source string, dest string) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	srcBucket, srcPrefix, srcIsS3 := parseS3URL(source)
+	dstBucket, dstPrefix, dstIsS3 := parseS3URL(dest)
+
+	switch {
+	case srcIsS3 && !dstIsS3:
+		return syncDown(ctx, client, srcBucket, srcPrefix, dest)
+	case !srcIsS3 && dstIsS3:
+		return syncUp(ctx, client, source, dstBucket, dstPrefix)
+	}
+
+	return errors.New("one of source and destination must be an s3:// URL and the other a directory")
+}
+
+func parseS3URL(v string) (bucket string, prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(v, "s3://")
+	if !ok {
+		return "", "", false
+	}
+
+	bucket, prefix, _ = strings.Cut(rest, "/")
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return bucket, prefix, true
+}
+
+func syncUp(
+	ctx context.Context, client *minio.Client,
+	dir string, bucket string, prefix string,
+) error {
+	var uploaded, skipped int
+
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasSuffix(name, metaSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return fmt.Errorf("get relative path: %w", err)
+		}
+
+		key := prefix + filepath.ToSlash(rel)
+
+		sums, err := fileChecksums(name)
+		if err != nil {
+			return err
+		}
+
+		sums.Meta, err = metaChecksum(name)
+		if err != nil {
+			return err
+		}
+
+		info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+
+		switch {
+		case isNotFound(err):
+		case err != nil:
+			return fmt.Errorf("stat %q: %w", key, err)
+		case sums.matches(info) && sums.metaMatches(info):
+			skipped++
+
+			return nil
+		}
+
+		opts, err := putOptions(name, sums)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.FPutObject(ctx, bucket, key, name, opts)
+		if err != nil {
+			return fmt.Errorf("upload %q: %w", key, err)
+		}
+
+		uploaded++
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("sync %q to %q: %w", dir, bucket, err)
+	}
+
+	fmt.Printf("Uploaded %d objects to %q, %d were unchanged\n",
+		uploaded, bucket, skipped)
+
+	return nil
+}
+
+func syncDown(
+	ctx context.Context, client *minio.Client,
+	bucket string, prefix string, dir string,
+) error {
+	var downloaded, skipped int
+
+	// Cancel the listing if we return early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for obj := range objects {
+		if obj.Err != nil {
+			return fmt.Errorf("list objects: %w", obj.Err)
+		}
+
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+
+		rel := strings.TrimPrefix(obj.Key, prefix)
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+rel)))
+
+		sums, err := fileChecksums(name)
+
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			// The listing doesn't include user metadata, stat
+			// objects that don't have an MD5 ETag.
+			info := obj
+			if strings.Contains(obj.ETag, "-") {
+				info, err = client.StatObject(ctx, bucket, obj.Key,
+					minio.StatObjectOptions{})
+				if err != nil {
+					return fmt.Errorf("stat %q: %w", obj.Key, err)
+				}
+			}
+
+			if sums.matches(info) {
+				skipped++
+
+				continue
+			}
+		}
+
+		err = client.FGetObject(ctx, bucket, obj.Key, name,
+			minio.GetObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("download %q: %w", obj.Key, err)
+		}
+
+		downloaded++
+	}
+
+	fmt.Printf("Downloaded %d objects from %q, %d were unchanged\n",
+		downloaded, bucket, skipped)
+
+	return nil
+}
+
+type checksums struct {
+	MD5    string
+	SHA256 string
+	// Meta is the SHA-256 checksum of the metadata sidecar file, empty if
+	// there is none.
+	Meta string
+}
+
+// matches compares the checksums to the SHA-256 metadata of an object, or
+// its ETag if it isn't a multipart ETag.
+func (c checksums) matches(info minio.ObjectInfo) bool {
+	sum, ok := userMetadata(info, checksumMeta)
+	if ok {
+		return sum == c.SHA256
+	}
+
+	etag := strings.Trim(info.ETag, `"`)
+
+	return !strings.Contains(etag, "-") && etag == c.MD5
+}
+
+// metaMatches compares the checksum of the metadata sidecar file to the
+// metadata of an object.
+func (c checksums) metaMatches(info minio.ObjectInfo) bool {
+	sum, _ := userMetadata(info, metaChecksumMeta)
+
+	return sum == c.Meta
+}
+
+func userMetadata(info minio.ObjectInfo, key string) (string, bool) {
+	for k, v := range info.UserMetadata {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+func fileChecksums(name string) (checksums, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return checksums{}, fmt.Errorf("open file: %w", err)
+	}
+
+	defer f.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), f)
+	if err != nil {
+		return checksums{}, fmt.Errorf("read %q: %w", name, err)
+	}
+
+	return checksums{
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
+
+// metaChecksum returns the SHA-256 checksum of the metadata sidecar file of
+// a file, or an empty string if it doesn't have one.
+func metaChecksum(name string) (string, error) {
+	data, err := os.ReadFile(name + metaSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("read metadata file: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readObjectMeta reads the metadata sidecar file of a file if there is one.
+// The content type is detected if it isn't set in the sidecar file.
+func readObjectMeta(name string) (ObjectMeta, error) {
+	var meta ObjectMeta
+
+	data, err := os.ReadFile(name + metaSuffix)
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return ObjectMeta{}, fmt.Errorf("read metadata file: %w", err)
+	default:
+		err = json.Unmarshal(data, &meta)
+		if err != nil {
+			return ObjectMeta{}, fmt.Errorf(
+				"unmarshal %q: %w", name+metaSuffix, err)
+		}
+	}
+
+	if meta.ContentType == "" {
+		meta.ContentType, err = detectContentType(name)
+		if err != nil {
+			return ObjectMeta{}, err
+		}
+	}
+
+	return meta, nil
+}
+
+// putOptions returns the minio upload options for the metadata.
+func (m ObjectMeta) putOptions() minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		ContentType:        m.ContentType,
+		ContentEncoding:    m.ContentEncoding,
+		ContentDisposition: m.ContentDisposition,
+		CacheControl:       m.CacheControl,
+		UserMetadata:       m.Metadata,
+		UserTags:           m.Tags,
+	}
+}
+
+// putOptions returns the upload options for a file, using the metadata
+// sidecar file if there is one. The checksums are stored in the object
+// metadata.
+func putOptions(name string, sums checksums) (minio.PutObjectOptions, error) {
+	meta, err := readObjectMeta(name)
+	if err != nil {
+		return minio.PutObjectOptions{}, err
+	}
+
+	userMeta := map[string]string{
+		checksumMeta: sums.SHA256,
+	}
+
+	if sums.Meta != "" {
+		userMeta[metaChecksumMeta] = sums.Meta
+	}
+
+	for k, v := range meta.Metadata {
+		userMeta[k] = v
+	}
+
+	meta.Metadata = userMeta
+
+	return meta.putOptions(), nil
+}
+
+func detectContentType(name string) (string, error) {
+	ct := mime.TypeByExtension(filepath.Ext(name))
+	if ct != "" {
+		return ct, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+
+	defer f.Close()
+
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read %q: %w", name, err)
+	}
+
+	return http.DetectContentType(head[:n]), nil
+}
+
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return minio.ToErrorResponse(err).StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,145 @@
+package s3
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestChecksumsMatch(t *testing.T) {
+	sums := checksums{
+		MD5:    "d41d8cd98f00b204e9800998ecf8427e",
+		SHA256: "e3b0c44298fc1c149afbf4c8996fb924",
+	}
+
+	withMeta := sums
+	withMeta.Meta = "5dbd0b33a2e34d21"
+
+	cases := []struct {
+		name string
+		sums checksums
+		info minio.ObjectInfo
+		want bool
+	}{
+		{
+			name: "checksum metadata",
+			sums: sums,
+			info: minio.ObjectInfo{
+				ETag:         "abc-2",
+				UserMetadata: minio.StringMap{"Sha256": sums.SHA256},
+			},
+			want: true,
+		},
+		{
+			name: "changed content",
+			sums: sums,
+			info: minio.ObjectInfo{
+				ETag:         sums.MD5,
+				UserMetadata: minio.StringMap{"Sha256": "other"},
+			},
+			want: false,
+		},
+		{
+			name: "etag",
+			sums: sums,
+			info: minio.ObjectInfo{ETag: `"` + sums.MD5 + `"`},
+			want: true,
+		},
+		{
+			name: "multipart etag",
+			sums: sums,
+			info: minio.ObjectInfo{ETag: sums.MD5 + "-2"},
+			want: false,
+		},
+		{
+			name: "added sidecar",
+			sums: withMeta,
+			info: minio.ObjectInfo{
+				UserMetadata: minio.StringMap{"Sha256": sums.SHA256},
+			},
+			want: false,
+		},
+		{
+			name: "unchanged sidecar",
+			sums: withMeta,
+			info: minio.ObjectInfo{
+				UserMetadata: minio.StringMap{
+					"Sha256":      sums.SHA256,
+					"Meta-Sha256": withMeta.Meta,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "removed sidecar",
+			sums: sums,
+			info: minio.ObjectInfo{
+				UserMetadata: minio.StringMap{
+					"Sha256":      sums.SHA256,
+					"Meta-Sha256": withMeta.Meta,
+				},
+			},
+			want: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.sums.matches(c.info) && c.sums.metaMatches(c.info)
+			if got != c.want {
+				t.Fatalf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestPutOptions(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "report.pdf")
+
+	err := os.WriteFile(name, []byte("%PDF"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(name+metaSuffix, []byte(`{
+  "cache_control": "max-age=3600",
+  "metadata": {"uuid": "5dbd0b33"},
+  "tags": {"kind": "report"}
+}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := putOptions(name, checksums{SHA256: "abc", Meta: "def"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.ContentType != "application/pdf" {
+		t.Fatalf("expected the detected content type, got %q",
+			opts.ContentType)
+	}
+
+	if opts.CacheControl != "max-age=3600" {
+		t.Fatalf("expected the sidecar cache control, got %q",
+			opts.CacheControl)
+	}
+
+	wantMeta := map[string]string{
+		checksumMeta:     "abc",
+		metaChecksumMeta: "def",
+		"uuid":           "5dbd0b33",
+	}
+
+	if !reflect.DeepEqual(opts.UserMetadata, wantMeta) {
+		t.Fatalf("expected metadata %v, got %v", wantMeta, opts.UserMetadata)
+	}
+
+	if !reflect.DeepEqual(opts.UserTags, map[string]string{"kind": "report"}) {
+		t.Fatalf("expected the sidecar tags, got %v", opts.UserTags)
+	}
+}
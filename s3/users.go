@@ -0,0 +1,192 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ttab/mage/internal"
+)
+
+var userNameExp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,64}$`)
+
+// User creates a user in the local minio instance with a policy that only
+// gives access to the listed buckets, and prints its access key and secret.
+// Buckets are given as a comma separated list of "bucket" or "bucket/prefix".
+// If S3_USER_ENV_FILE is set the credentials are written to that env file
+// instead. Running the target again for an existing user replaces its secret
+// and policy.
+func User(name string, buckets string) error {
+	if !userNameExp.MatchString(name) {
+		return fmt.Errorf("invalid user name %q", name)
+	}
+
+	policy, err := userPolicy(strings.Split(buckets, ","))
+	if err != nil {
+		return err
+	}
+
+	running, err := internal.ContainerRunning(instanceName)
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		return errors.New("the local minio instance isn't running, start it with s3:minio")
+	}
+
+	cfg, err := LoadMinioConfig()
+	if err != nil {
+		return err
+	}
+
+	secret := make([]byte, 20)
+
+	_, err = rand.Read(secret)
+	if err != nil {
+		return fmt.Errorf("generate secret: %w", err)
+	}
+
+	env := map[string]string{
+		"MC_HOST_local": (&url.URL{
+			Scheme: "http",
+			Host:   "localhost:9000",
+			User:   url.UserPassword(cfg.AccessKey, cfg.SecretKey),
+		}).String(),
+		"USER_ACCESS_KEY": name,
+		"USER_SECRET_KEY": hex.EncodeToString(secret),
+	}
+
+	policyName := name + "-access"
+
+	_, err = internal.ContainerExec(instanceName, nil, nil,
+		"sh", "-c", "command -v mc")
+	if err != nil {
+		return fmt.Errorf(
+			"the minio client mc isn't available in the %q image, use an image that includes it: %w",
+			cfg.Image, err)
+	}
+
+	steps := []struct {
+		Desc  string
+		Stdin string
+		Cmd   string
+		// Tolerate is a part of the error message that is ignored.
+		Tolerate string
+	}{
+		{
+			Desc: "create user",
+			Cmd:  `mc admin user add local "$USER_ACCESS_KEY" "$USER_SECRET_KEY"`,
+		},
+		{
+			Desc:  "create policy",
+			Stdin: policy,
+			Cmd:   "mc admin policy create local " + policyName + " /dev/stdin",
+		},
+		{
+			Desc: "attach policy",
+			Cmd: "mc admin policy attach local " + policyName +
+				` --user "$USER_ACCESS_KEY"`,
+			// Attaching a policy that already is attached fails.
+			Tolerate: "policy change is already in effect",
+		},
+	}
+
+	for _, step := range steps {
+		var stdin io.Reader
+
+		if step.Stdin != "" {
+			stdin = strings.NewReader(step.Stdin)
+		}
+
+		out, err := internal.ContainerExec(instanceName, env, stdin,
+			"sh", "-c", step.Cmd)
+
+		if err != nil && step.Tolerate != "" &&
+			strings.Contains(out, step.Tolerate) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.Desc, err)
+		}
+	}
+
+	creds := map[string]string{
+		"S3_ENDPOINT":          "http://" + cfg.Endpoint(),
+		"S3_ACCESS_KEY_ID":     env["USER_ACCESS_KEY"],
+		"S3_SECRET_ACCESS_KEY": env["USER_SECRET_KEY"],
+	}
+
+	envFile := os.Getenv("S3_USER_ENV_FILE")
+	if envFile != "" {
+		err := internal.UpdateEnvFile(envFile, creds)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Wrote the credentials for %q to %s\n", name, envFile)
+
+		return nil
+	}
+
+	fmt.Printf("Access key: %s\nSecret key: %s\n",
+		creds["S3_ACCESS_KEY_ID"], creds["S3_SECRET_ACCESS_KEY"])
+
+	return nil
+}
+
+// userPolicy creates a policy document that gives read and write access to
+// the buckets and prefixes.
+func userPolicy(buckets []string) (string, error) {
+	var statements []map[string]any
+
+	for _, b := range buckets {
+		bucket, prefix, _ := strings.Cut(strings.TrimSpace(b), "/")
+		if bucket == "" {
+			return "", fmt.Errorf("invalid bucket %q", b)
+		}
+
+		list := map[string]any{
+			"Effect":   "Allow",
+			"Action":   []string{"s3:ListBucket", "s3:GetBucketLocation"},
+			"Resource": []string{"arn:aws:s3:::" + bucket},
+		}
+
+		if prefix != "" {
+			list["Condition"] = map[string]any{
+				"StringLike": map[string]any{
+					"s3:prefix": []string{prefix, prefix + "*"},
+				},
+			}
+		}
+
+		statements = append(statements, list, map[string]any{
+			"Effect": "Allow",
+			"Action": []string{
+				"s3:GetObject", "s3:PutObject", "s3:DeleteObject",
+				"s3:ListMultipartUploadParts", "s3:AbortMultipartUpload",
+			},
+			"Resource": []string{
+				fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, prefix),
+			},
+		})
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal policy: %w", err)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,156 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ttab/mage/internal"
+)
+
+// NoAutostartEnv is the environment variable that switches off the automatic
+// start of the local Postgres instance when set to a true value.
+const NoAutostartEnv = "TT_MAGE_NO_AUTOSTART"
+
+// ensurePostgres starts the local Postgres instance if the project connection
+// string points to localhost and nothing is listening on the port. The
+// instance is selected using the POSTGRES_INSTANCE environment variable, or
+// automatically if there only is one instance in the state directory.
+func ensurePostgres(ctx context.Context) error {
+	noAutostart, _ := strconv.ParseBool(os.Getenv(NoAutostartEnv))
+	if noAutostart {
+		return nil
+	}
+
+	info, err := GetConnInfo()
+	if err != nil {
+		return err
+	}
+
+	if !isLocalHost(info.Host) {
+		return nil
+	}
+
+	addr := net.JoinHostPort(info.Host, strconv.Itoa(int(info.Port)))
+
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err == nil {
+		_ = conn.Close()
+
+		return nil
+	}
+
+	name, err := localInstanceName()
+	if err != nil {
+		return fmt.Errorf("nothing is listening on %s: %w", addr, err)
+	}
+
+	running, err := internal.ContainerRunning("postgres-" + name)
+	if err != nil {
+		return fmt.Errorf("check postgres container: %w", err)
+	}
+
+	if !running {
+		fmt.Printf("Starting the local Postgres instance %q\n", name)
+
+		err := Postgres(name)
+		if err != nil {
+			return fmt.Errorf("start postgres: %w", err)
+		}
+
+		return nil
+	}
+
+	return waitForPostgres(ctx)
+}
+
+// localInstanceName returns the name of the local Postgres instance to use.
+func localInstanceName() (string, error) {
+	name := os.Getenv("POSTGRES_INSTANCE")
+	if name != "" {
+		return name, nil
+	}
+
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return "", fmt.Errorf("get state directory path: %w", err)
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(stateDir, "postgres-*"))
+	if err != nil {
+		return "", fmt.Errorf("list postgres instances: %w", err)
+	}
+
+	var names []string
+
+	for _, dir := range dirs {
+		isDir, err := internal.DirectoryExists(dir)
+		if err != nil || !isDir {
+			continue
+		}
+
+		names = append(names,
+			strings.TrimPrefix(filepath.Base(dir), "postgres-"))
+	}
+
+	slices.Sort(names)
+
+	switch len(names) {
+	case 0:
+		return "", errors.New("no local postgres instance, create one with sql:postgres")
+	case 1:
+		return names[0], nil
+	}
+
+	return "", fmt.Errorf(
+		"more than one local postgres instance (%s), set POSTGRES_INSTANCE to pick one",
+		strings.Join(names, ", "))
+}
+
+// waitForPostgres waits until the local Postgres instance accepts
+// connections.
+func waitForPostgres(ctx context.Context) error {
+	return internal.WaitFor(ctx, "postgres", 30*time.Second,
+		func(ctx context.Context) error {
+			conn, err := connect(ctx, adminConnString)
+			if err != nil {
+				return err
+			}
+
+			return conn.Close(ctx)
+		})
+}
+
+// localConnInfo returns the connection info for the project database, and
+// fails if it isn't on the local Postgres instance. Used by targets that
+// manage the database with the local admin role.
+func localConnInfo(target string) (*ConnInfo, error) {
+	info, err := GetConnInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isLocalHost(info.Host) {
+		return nil, fmt.Errorf(
+			"%s only works with the local Postgres instance, the project database is on %q",
+			target, info.Host)
+	}
+
+	return info, nil
+}
+
+func isLocalHost(host string) bool {
+	switch host {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,601 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/mage/ia"
+)
+
+// GrantSpec declares the privileges of a set of roles.
+type GrantSpec struct {
+	Roles []RoleGrants `json:"roles"`
+}
+
+// RoleGrants declares the privileges of a role. Any privileges that the role
+// has been granted that aren't declared will be revoked, with the exception
+// of privileges on objects that the role owns.
+type RoleGrants struct {
+	Name              string             `json:"name"`
+	Schemas           []SchemaGrant      `json:"schemas"`
+	Tables            []TableGrant       `json:"tables"`
+	Sequences         []SequenceGrant    `json:"sequences"`
+	DefaultPrivileges []DefaultPrivilege `json:"default_privileges"`
+}
+
+// SchemaGrant grants privileges on a schema, f.ex. USAGE.
+type SchemaGrant struct {
+	Schema     string   `json:"schema"`
+	Privileges []string `json:"privileges"`
+}
+
+// TableGrant grants privileges on a table, or on specific columns in a table
+// if columns are listed.
+type TableGrant struct {
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	Privileges []string `json:"privileges"`
+}
+
+// SequenceGrant grants privileges on a sequence, f.ex. USAGE.
+type SequenceGrant struct {
+	Sequence   string   `json:"sequence"`
+	Privileges []string `json:"privileges"`
+}
+
+// DefaultPrivilege grants privileges on objects that will be created in a
+// schema in the future.
+type DefaultPrivilege struct {
+	Schema string `json:"schema"`
+	// ObjectType is one of "tables", "sequences", "functions", or "types".
+	ObjectType string `json:"object_type"`
+	// ForRole is the role that creates the objects, defaults to the role
+	// that applies the grants.
+	ForRole    string   `json:"for_role"`
+	Privileges []string `json:"privileges"`
+}
+
+var defaultACLTypes = map[string]string{
+	"tables":    "r",
+	"sequences": "S",
+	"functions": "f",
+	"types":     "T",
+}
+
+var (
+	tablePrivileges = []string{
+		"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE",
+		"REFERENCES", "TRIGGER", "MAINTAIN",
+	}
+	sequencePrivileges = []string{"USAGE", "SELECT", "UPDATE"}
+)
+
+// grantPrivileges are the privileges that can be granted on each kind of
+// object, including the object types of default privileges.
+var grantPrivileges = map[string][]string{
+	"schema":    {"USAGE", "CREATE"},
+	"table":     tablePrivileges,
+	"column":    {"SELECT", "INSERT", "UPDATE", "REFERENCES"},
+	"sequence":  sequencePrivileges,
+	"tables":    tablePrivileges,
+	"sequences": sequencePrivileges,
+	"functions": {"EXECUTE"},
+	"types":     {"USAGE"},
+}
+
+// checkPrivilege returns the privilege in upper case if it can be granted on
+// the kind of object. ALL is rejected as the current privileges are listed
+// individually and would never match it.
+func checkPrivilege(kind string, privilege string) (string, error) {
+	p := strings.ToUpper(strings.TrimSpace(privilege))
+
+	if p == "ALL" || p == "ALL PRIVILEGES" {
+		return "", errors.New(
+			"list the privileges explicitly instead of using ALL")
+	}
+
+	if !slices.Contains(grantPrivileges[kind], p) {
+		return "", fmt.Errorf("invalid %s privilege %q, must be one of %s",
+			kind, privilege, strings.Join(grantPrivileges[kind], ", "))
+	}
+
+	return p, nil
+}
+
+// ApplyGrants applies the privileges declared in "./postgres/grants.json" to a
+// database. The connection string is read from GRANTS_CONN_STRING or prompted
+// for, and the user will be shown the plan and asked for confirmation before
+// any changes are made.
+func ApplyGrants(ctx context.Context) error {
+	return applyGrantsFile(ctx, false)
+}
+
+// PlanGrants prints the SQL statements that ApplyGrants would execute without
+// making any changes.
+func PlanGrants(ctx context.Context) error {
+	return applyGrantsFile(ctx, true)
+}
+
+func applyGrantsFile(ctx context.Context, dryRun bool) error {
+	data, err := os.ReadFile(filepath.Join("postgres", "grants.json"))
+	if err != nil {
+		return fmt.Errorf("read grants file: %w", err)
+	}
+
+	var spec GrantSpec
+
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		return fmt.Errorf("unmarshal grants file: %w", err)
+	}
+
+	connStr, err := ia.Resolve(ia.Prompt{
+		Label:    "Enter connection string (empty for the local database)",
+		Key:      "GRANTS_CONN_STRING",
+		Secret:   true,
+		Validate: validateConnString,
+	})
+	if err != nil {
+		return fmt.Errorf("get connection string: %w", err)
+	}
+
+	if connStr == "" {
+		err = ensurePostgres(ctx)
+		if err != nil {
+			return err
+		}
+
+		connStr = MustGetConnString()
+	}
+
+	return ManageGrants(ctx, connStr, spec, dryRun)
+}
+
+// ManageGrants computes the difference between the declared privileges and
+// the privileges in the database and prints the GRANT and REVOKE statements
+// needed to reconcile them. Unless dryRun is set the user is asked to confirm
+// the plan, and it's then applied in a single transaction.
+func ManageGrants(
+	ctx context.Context, connString string, spec GrantSpec, dryRun bool,
+) error {
+	conn, err := connect(ctx, connString)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	statements, err := planGrants(ctx, conn, spec)
+	if err != nil {
+		return err
+	}
+
+	if len(statements) == 0 {
+		fmt.Println("No changes, the privileges are up to date.")
+
+		return nil
+	}
+
+	for _, stmt := range statements {
+		fmt.Println(stmt + ";")
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	ok, err := ia.Confirm(fmt.Sprintf(
+		"Apply %d statements", len(statements)))
+	if err != nil {
+		return fmt.Errorf("confirm plan: %w", err)
+	}
+
+	if !ok {
+		return errors.New("aborted")
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	for _, stmt := range statements {
+		_, err := tx.Exec(ctx, stmt)
+		if err != nil {
+			return fmt.Errorf("execute %q: %w", stmt, err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+type grant struct {
+	Role       string
+	Schema     string
+	Table      string
+	Sequence   string
+	Column     string
+	ForRole    string
+	ObjectType string
+	Privilege  string
+}
+
+func (g grant) target() string {
+	switch {
+	case g.ObjectType != "":
+		return "default"
+	case g.Column != "":
+		return "column"
+	case g.Table != "":
+		return "table"
+	case g.Sequence != "":
+		return "sequence"
+	}
+
+	return "schema"
+}
+
+func (g grant) statement(revoke bool) string {
+	verb, prep := "GRANT", "TO"
+	if revoke {
+		verb, prep = "REVOKE", "FROM"
+	}
+
+	role := quoteIdentifier(g.Role)
+
+	switch g.target() {
+	case "default":
+		var objType string
+
+		for name, t := range defaultACLTypes {
+			if t == g.ObjectType {
+				objType = strings.ToUpper(name)
+			}
+		}
+
+		return fmt.Sprintf(
+			"ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s %s %s ON %s %s %s",
+			quoteIdentifier(g.ForRole), quoteIdentifier(g.Schema),
+			verb, g.Privilege, objType, prep, role)
+	case "column":
+		return fmt.Sprintf("%s %s (%s) ON TABLE %s %s %s",
+			verb, g.Privilege, quoteIdentifier(g.Column),
+			g.Table, prep, role)
+	case "table":
+		return fmt.Sprintf("%s %s ON TABLE %s %s %s",
+			verb, g.Privilege, g.Table, prep, role)
+	case "sequence":
+		return fmt.Sprintf("%s %s ON SEQUENCE %s %s %s",
+			verb, g.Privilege, g.Sequence, prep, role)
+	}
+
+	return fmt.Sprintf("%s %s ON SCHEMA %s %s %s",
+		verb, g.Privilege, quoteIdentifier(g.Schema), prep, role)
+}
+
+// planGrants returns the statements needed to bring the database in line
+// with the grant spec. Roles that don't exist are created without login.
+func planGrants(
+	ctx context.Context, conn *pgx.Conn, spec GrantSpec,
+) ([]string, error) {
+	var statements []string
+
+	for _, role := range spec.Roles {
+		if role.Name == "" {
+			return nil, errors.New("role without a name")
+		}
+
+		var exists bool
+
+		err := conn.QueryRow(ctx,
+			"SELECT EXISTS (SELECT FROM pg_roles WHERE rolname = $1)",
+			role.Name,
+		).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("check for role %q: %w", role.Name, err)
+		}
+
+		desired, err := desiredGrants(ctx, conn, role)
+		if err != nil {
+			return nil, fmt.Errorf("role %q: %w", role.Name, err)
+		}
+
+		current := make(map[grant]bool)
+
+		if exists {
+			current, err = currentGrants(ctx, conn, role.Name)
+			if err != nil {
+				return nil, fmt.Errorf("role %q: %w", role.Name, err)
+			}
+		} else {
+			statements = append(statements, fmt.Sprintf(
+				"CREATE ROLE %s", quoteIdentifier(role.Name)))
+		}
+
+		statements = append(statements,
+			grantStatements(current, desired)...)
+	}
+
+	return statements, nil
+}
+
+// grantStatements returns the REVOKE statements for the current grants that
+// aren't desired followed by the GRANT statements for the desired grants that
+// are missing.
+func grantStatements(current, desired map[grant]bool) []string {
+	var revokes, grants []string
+
+	for g := range current {
+		if !desired[g] {
+			revokes = append(revokes, g.statement(true))
+		}
+	}
+
+	for g := range desired {
+		if !current[g] {
+			grants = append(grants, g.statement(false))
+		}
+	}
+
+	slices.Sort(revokes)
+	slices.Sort(grants)
+
+	return append(revokes, grants...)
+}
+
+func desiredGrants(
+	ctx context.Context, conn *pgx.Conn, role RoleGrants,
+) (map[grant]bool, error) {
+	desired := make(map[grant]bool)
+
+	for _, s := range role.Schemas {
+		for _, p := range s.Privileges {
+			privilege, err := checkPrivilege("schema", p)
+			if err != nil {
+				return nil, fmt.Errorf("schema %q: %w", s.Schema, err)
+			}
+
+			desired[grant{
+				Role:      role.Name,
+				Schema:    s.Schema,
+				Privilege: privilege,
+			}] = true
+		}
+	}
+
+	for _, t := range role.Tables {
+		var table string
+
+		err := conn.QueryRow(ctx,
+			"SELECT coalesce(to_regclass($1)::text, '')", t.Table,
+		).Scan(&table)
+		if err != nil {
+			return nil, fmt.Errorf("resolve table %q: %w", t.Table, err)
+		}
+
+		if table == "" {
+			return nil, fmt.Errorf("the table %q doesn't exist", t.Table)
+		}
+
+		kind := "table"
+		if len(t.Columns) > 0 {
+			kind = "column"
+		}
+
+		for _, p := range t.Privileges {
+			privilege, err := checkPrivilege(kind, p)
+			if err != nil {
+				return nil, fmt.Errorf("table %q: %w", t.Table, err)
+			}
+
+			if len(t.Columns) == 0 {
+				desired[grant{
+					Role:      role.Name,
+					Table:     table,
+					Privilege: privilege,
+				}] = true
+
+				continue
+			}
+
+			for _, col := range t.Columns {
+				desired[grant{
+					Role:      role.Name,
+					Table:     table,
+					Column:    col,
+					Privilege: privilege,
+				}] = true
+			}
+		}
+	}
+
+	for _, sg := range role.Sequences {
+		var sequence string
+
+		err := conn.QueryRow(ctx, `
+SELECT coalesce(c.oid::regclass::text, '')
+FROM (SELECT to_regclass($1) AS oid) AS r
+     LEFT JOIN pg_class AS c ON c.oid = r.oid AND c.relkind = 'S'`,
+			sg.Sequence,
+		).Scan(&sequence)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"resolve sequence %q: %w", sg.Sequence, err)
+		}
+
+		if sequence == "" {
+			return nil, fmt.Errorf(
+				"the sequence %q doesn't exist", sg.Sequence)
+		}
+
+		for _, p := range sg.Privileges {
+			privilege, err := checkPrivilege("sequence", p)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"sequence %q: %w", sg.Sequence, err)
+			}
+
+			desired[grant{
+				Role:      role.Name,
+				Sequence:  sequence,
+				Privilege: privilege,
+			}] = true
+		}
+	}
+
+	for _, d := range role.DefaultPrivileges {
+		objType, ok := defaultACLTypes[d.ObjectType]
+		if !ok {
+			return nil, fmt.Errorf(
+				"unknown default privilege object type %q",
+				d.ObjectType)
+		}
+
+		var forRole string
+
+		err := conn.QueryRow(ctx,
+			"SELECT coalesce(nullif($1, ''), current_user)::text",
+			d.ForRole,
+		).Scan(&forRole)
+		if err != nil {
+			return nil, fmt.Errorf("resolve role: %w", err)
+		}
+
+		for _, p := range d.Privileges {
+			privilege, err := checkPrivilege(d.ObjectType, p)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"default privileges on %s in %q: %w",
+					d.ObjectType, d.Schema, err)
+			}
+
+			desired[grant{
+				Role:       role.Name,
+				Schema:     d.Schema,
+				ForRole:    forRole,
+				ObjectType: objType,
+				Privilege:  privilege,
+			}] = true
+		}
+	}
+
+	return desired, nil
+}
+
+func currentGrants(
+	ctx context.Context, conn *pgx.Conn, role string,
+) (map[grant]bool, error) {
+	current := make(map[grant]bool)
+
+	queries := []struct {
+		Name  string
+		Query string
+		Scan  func(row pgx.Rows, g *grant) error
+	}{
+		{
+			Name: "schema",
+			Query: `
+SELECT n.nspname::text, a.privilege_type
+FROM pg_roles AS r, pg_namespace AS n, aclexplode(n.nspacl) AS a
+WHERE r.rolname = $1 AND a.grantee = r.oid AND n.nspowner <> r.oid`,
+			Scan: func(row pgx.Rows, g *grant) error {
+				return row.Scan(&g.Schema, &g.Privilege)
+			},
+		},
+		{
+			Name: "table",
+			Query: `
+SELECT c.oid::regclass::text, a.privilege_type
+FROM pg_roles AS r, pg_class AS c, aclexplode(c.relacl) AS a
+WHERE r.rolname = $1 AND a.grantee = r.oid AND c.relowner <> r.oid
+      AND c.relkind IN ('r', 'v', 'm', 'p', 'f')`,
+			Scan: func(row pgx.Rows, g *grant) error {
+				return row.Scan(&g.Table, &g.Privilege)
+			},
+		},
+		{
+			Name: "sequence",
+			Query: `
+SELECT c.oid::regclass::text, a.privilege_type
+FROM pg_roles AS r, pg_class AS c, aclexplode(c.relacl) AS a
+WHERE r.rolname = $1 AND a.grantee = r.oid AND c.relowner <> r.oid
+      AND c.relkind = 'S'`,
+			Scan: func(row pgx.Rows, g *grant) error {
+				return row.Scan(&g.Sequence, &g.Privilege)
+			},
+		},
+		{
+			Name: "column",
+			Query: `
+SELECT c.oid::regclass::text, att.attname::text, a.privilege_type
+FROM pg_roles AS r,
+     pg_attribute AS att
+     JOIN pg_class AS c ON c.oid = att.attrelid,
+     aclexplode(att.attacl) AS a
+WHERE r.rolname = $1 AND a.grantee = r.oid AND c.relowner <> r.oid
+      AND NOT att.attisdropped`,
+			Scan: func(row pgx.Rows, g *grant) error {
+				return row.Scan(&g.Table, &g.Column, &g.Privilege)
+			},
+		},
+		{
+			Name: "default",
+			Query: `
+SELECT pg_get_userbyid(d.defaclrole)::text, n.nspname::text,
+       d.defaclobjtype::text, a.privilege_type
+FROM pg_roles AS r,
+     pg_default_acl AS d
+     JOIN pg_namespace AS n ON n.oid = d.defaclnamespace,
+     aclexplode(d.defaclacl) AS a
+WHERE r.rolname = $1 AND a.grantee = r.oid`,
+			Scan: func(row pgx.Rows, g *grant) error {
+				return row.Scan(&g.ForRole, &g.Schema,
+					&g.ObjectType, &g.Privilege)
+			},
+		},
+	}
+
+	for _, q := range queries {
+		rows, err := conn.Query(ctx, q.Query, role)
+		if err != nil {
+			return nil, fmt.Errorf("list %s privileges: %w", q.Name, err)
+		}
+
+		for rows.Next() {
+			g := grant{Role: role}
+
+			err := q.Scan(rows, &g)
+			if err != nil {
+				rows.Close()
+
+				return nil, fmt.Errorf(
+					"read %s privilege: %w", q.Name, err)
+			}
+
+			current[g] = true
+		}
+
+		if rows.Err() != nil {
+			return nil, fmt.Errorf(
+				"list %s privileges: %w", q.Name, rows.Err())
+		}
+	}
+
+	return current, nil
+}
@@ -0,0 +1,136 @@
+package sql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGrantStatements(t *testing.T) {
+	var (
+		usage = grant{
+			Role: "reporting", Schema: "public", Privilege: "USAGE",
+		}
+		selectDoc = grant{
+			Role: "reporting", Table: "public.document", Privilege: "SELECT",
+		}
+		selectName = grant{
+			Role: "reporting", Table: "public.author",
+			Column: "name", Privilege: "SELECT",
+		}
+		useSeq = grant{
+			Role: "reporting", Sequence: "public.document_id_seq",
+			Privilege: "USAGE",
+		}
+		defaultSelect = grant{
+			Role: "reporting", Schema: "public", ForRole: "admin",
+			ObjectType: "r", Privilege: "SELECT",
+		}
+	)
+
+	cases := []struct {
+		name    string
+		current []grant
+		desired []grant
+		want    []string
+	}{
+		{
+			name:    "up to date",
+			current: []grant{usage, selectDoc},
+			desired: []grant{usage, selectDoc},
+		},
+		{
+			name:    "grant everything",
+			desired: []grant{usage, selectDoc, selectName, useSeq, defaultSelect},
+			want: []string{
+				`ALTER DEFAULT PRIVILEGES FOR ROLE "admin" IN SCHEMA "public" GRANT SELECT ON TABLES TO "reporting"`,
+				`GRANT SELECT ("name") ON TABLE public.author TO "reporting"`,
+				`GRANT SELECT ON TABLE public.document TO "reporting"`,
+				`GRANT USAGE ON SCHEMA "public" TO "reporting"`,
+				`GRANT USAGE ON SEQUENCE public.document_id_seq TO "reporting"`,
+			},
+		},
+		{
+			name:    "revokes come first",
+			current: []grant{usage, useSeq, defaultSelect},
+			desired: []grant{usage, selectDoc},
+			want: []string{
+				`ALTER DEFAULT PRIVILEGES FOR ROLE "admin" IN SCHEMA "public" REVOKE SELECT ON TABLES FROM "reporting"`,
+				`REVOKE USAGE ON SEQUENCE public.document_id_seq FROM "reporting"`,
+				`GRANT SELECT ON TABLE public.document TO "reporting"`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := grantStatements(grantSet(c.current), grantSet(c.desired))
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func grantSet(grants []grant) map[grant]bool {
+	set := make(map[grant]bool, len(grants))
+
+	for _, g := range grants {
+		set[g] = true
+	}
+
+	return set
+}
+
+func TestCheckPrivilege(t *testing.T) {
+	cases := []struct {
+		kind      string
+		privilege string
+		want      string
+		err       string
+	}{
+		{kind: "table", privilege: "select", want: "SELECT"},
+		{kind: "column", privilege: " Update ", want: "UPDATE"},
+		{kind: "schema", privilege: "usage", want: "USAGE"},
+		{kind: "sequence", privilege: "usage", want: "USAGE"},
+		{kind: "functions", privilege: "execute", want: "EXECUTE"},
+		{
+			kind: "schema", privilege: "all",
+			err: "list the privileges explicitly instead of using ALL",
+		},
+		{
+			kind: "tables", privilege: "ALL PRIVILEGES",
+			err: "list the privileges explicitly instead of using ALL",
+		},
+		{
+			kind: "column", privilege: "DELETE",
+			err: `invalid column privilege "DELETE", must be one of SELECT, INSERT, UPDATE, REFERENCES`,
+		},
+		{
+			kind: "table", privilege: "SELECT; DROP TABLE x",
+			err: `invalid table privilege "SELECT; DROP TABLE x", must be one of SELECT, INSERT, UPDATE, DELETE, TRUNCATE, REFERENCES, TRIGGER, MAINTAIN`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.kind+" "+c.privilege, func(t *testing.T) {
+			got, err := checkPrivilege(c.kind, c.privilege)
+
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != c.want {
+				t.Fatalf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
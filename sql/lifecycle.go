@@ -0,0 +1,72 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ttab/mage/ia"
+	"github.com/ttab/mage/internal"
+)
+
+// Stop stops the local Postgres instance, the data is kept and the instance
+// can be started again with Postgres.
+func Stop(name string) error {
+	err := internal.StopContainerIfExists("postgres-" + name)
+	if err != nil {
+		return fmt.Errorf("stop postgres: %w", err)
+	}
+
+	return nil
+}
+
+// Logs follows the logs of the local Postgres instance.
+func Logs(name string) error {
+	return internal.ContainerLogs("postgres-" + name)
+}
+
+// Destroy stops the local Postgres instance and deletes its data after
+// confirmation. The name follows the same rules as database names.
+func Destroy(name string) error {
+	err := validateDBName(name)
+	if err != nil {
+		return err
+	}
+
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return fmt.Errorf("get state directory path: %w", err)
+	}
+
+	instanceName := "postgres-" + name
+	dataDir := filepath.Join(stateDir, instanceName)
+
+	rel, err := filepath.Rel(stateDir, dataDir)
+	if err != nil || rel != instanceName {
+		return fmt.Errorf("data directory %q is outside of %q",
+			dataDir, stateDir)
+	}
+
+	ok, err := ia.Confirm(fmt.Sprintf(
+		"Delete the Postgres instance %q and all data in %s", name, dataDir))
+	if err != nil {
+		return fmt.Errorf("confirm deletion: %w", err)
+	}
+
+	if !ok {
+		return errors.New("aborted")
+	}
+
+	err = internal.StopContainerIfExists(instanceName)
+	if err != nil {
+		return fmt.Errorf("stop postgres: %w", err)
+	}
+
+	err = os.RemoveAll(dataDir)
+	if err != nil {
+		return fmt.Errorf("remove data directory: %w", err)
+	}
+
+	return nil
+}
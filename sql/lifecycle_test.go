@@ -0,0 +1,17 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDestroyInvalidName(t *testing.T) {
+	for _, name := range []string{"", "..", "../../home", "a/b"} {
+		t.Run(name, func(t *testing.T) {
+			err := Destroy(name)
+			if err == nil || !strings.Contains(err.Error(), "invalid database name") {
+				t.Fatalf("expected an invalid name error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// queryPlan is the summary of the generic plan for a query.
+type queryPlan struct {
+	Cost     float64         `json:"cost"`
+	SeqScans []string        `json:"seq_scans,omitempty"`
+	Plan     json.RawMessage `json:"plan"`
+
+	scans []planTable
+}
+
+// planTable is a table that's referenced by a plan node.
+type planTable struct {
+	Schema   string
+	Relation string
+}
+
+// String returns the schema qualified table name.
+func (t planTable) String() string {
+	return t.Schema + "." + t.Relation
+}
+
+// PlanBaseline explains the generic plans of all named queries and writes
+// them to "./postgres/plans.json" as a baseline for PlanCheck. The plans are
+// keyed by the package and name of the query, f.ex. "postgres.GetDocument".
+func PlanBaseline(ctx context.Context) error {
+	plans, err := explainQueries(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(plans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal plans: %w", err)
+	}
+
+	err = os.WriteFile(planBaselineFile(), append(data, '\n'), 0o600)
+	if err != nil {
+		return fmt.Errorf("write plan baseline: %w", err)
+	}
+
+	return nil
+}
+
+// PlanCheck explains the generic plans of all named queries and compares them
+// to the baseline in "./postgres/plans.json". Sequential scans on tables with
+// more than PLAN_SEQ_SCAN_ROWS (default 10000) estimated rows that aren't in
+// the baseline, and cost increases of more than PLAN_COST_INCREASE percent
+// (default 50) are reported as regressions.
+//
+// Run against a migrated database with representative seed data, the tables
+// are analyzed before the queries are explained.
+func PlanCheck(ctx context.Context) error {
+	seqScanRows, err := envInt("PLAN_SEQ_SCAN_ROWS", 10000)
+	if err != nil {
+		return err
+	}
+
+	costIncrease, err := envInt("PLAN_COST_INCREASE", 50)
+	if err != nil {
+		return err
+	}
+
+	baseline := make(map[string]queryPlan)
+
+	data, err := os.ReadFile(planBaselineFile())
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Println("No plan baseline, run sql:planBaseline to create one.")
+	case err != nil:
+		return fmt.Errorf("read plan baseline: %w", err)
+	default:
+		err = json.Unmarshal(data, &baseline)
+		if err != nil {
+			return fmt.Errorf("unmarshal plan baseline: %w", err)
+		}
+	}
+
+	plans, err := explainQueries(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connect(ctx, MustGetConnString())
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	names := make([]string, 0, len(plans))
+
+	for name := range plans {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	var regressions int
+
+	for _, name := range names {
+		plan := plans[name]
+		base, hasBase := baseline[name]
+
+		for _, table := range plan.scans {
+			if hasBase && slices.Contains(base.SeqScans, table.String()) {
+				continue
+			}
+
+			rows, err := estimatedRows(ctx, conn, table)
+			if err != nil {
+				return err
+			}
+
+			if rows < int64(seqScanRows) {
+				continue
+			}
+
+			regressions++
+
+			fmt.Printf("%s: sequential scan on %q (~%d rows)\n",
+				name, table.String(), rows)
+		}
+
+		limit := base.Cost * (1 + float64(costIncrease)/100)
+
+		if hasBase && base.Cost > 0 && plan.Cost > limit {
+			regressions++
+
+			fmt.Printf("%s: cost increased from %.2f to %.2f\n",
+				name, base.Cost, plan.Cost)
+		}
+	}
+
+	if regressions > 0 {
+		return fmt.Errorf("found %d query plan regressions", regressions)
+	}
+
+	return nil
+}
+
+func planBaselineFile() string {
+	return filepath.Join("postgres", "plans.json")
+}
+
+// explainQueries explains the generic plans of the named queries in the
+// project query files.
+func explainQueries(ctx context.Context) (map[string]queryPlan, error) {
+	files, err := queryFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ensurePostgres(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := connect(ctx, MustGetConnString())
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "ANALYZE")
+	if err != nil {
+		return nil, fmt.Errorf("analyze tables: %w", err)
+	}
+
+	plans := make(map[string]queryPlan)
+
+	for _, file := range files {
+		queries, err := parseQueryFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", file, err)
+		}
+
+		for _, q := range queries {
+			plan, err := explainQuery(ctx, conn, q)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: explain %s: %w",
+					q.File, q.Line, q.Name, err)
+			}
+
+			plans[q.id()] = plan
+		}
+	}
+
+	return plans, nil
+}
+
+// explainQuery explains the generic plan of a query, which allows queries
+// with parameters to be explained without providing values. The plan is
+// verbose so that the nodes include the schema of the scanned tables.
+func explainQuery(
+	ctx context.Context, conn *pgx.Conn, q namedQuery,
+) (queryPlan, error) {
+	// Use the simple protocol through pgconn, as pgx would refuse to send
+	// a query with parameters without values.
+	results, err := conn.PgConn().Exec(ctx,
+		"EXPLAIN (FORMAT JSON, GENERIC_PLAN, VERBOSE) "+positionalSQL(q.SQL),
+	).ReadAll()
+	if err != nil {
+		return queryPlan{}, fmt.Errorf("run explain: %w", err)
+	}
+
+	if len(results) != 1 || len(results[0].Rows) != 1 {
+		return queryPlan{}, errors.New("unexpected explain result")
+	}
+
+	raw := results[0].Rows[0][0]
+
+	var explained []struct {
+		Plan planNode `json:"Plan"`
+	}
+
+	err = json.Unmarshal(raw, &explained)
+	if err != nil {
+		return queryPlan{}, fmt.Errorf("unmarshal plan: %w", err)
+	}
+
+	if len(explained) == 0 {
+		return queryPlan{}, errors.New("empty plan")
+	}
+
+	root := explained[0].Plan
+	scans := root.seqScans()
+
+	names := make([]string, len(scans))
+
+	for i := range scans {
+		names[i] = scans[i].String()
+	}
+
+	return queryPlan{
+		Cost:     root.TotalCost,
+		SeqScans: names,
+		Plan:     raw,
+		scans:    scans,
+	}, nil
+}
+
+type planNode struct {
+	NodeType  string     `json:"Node Type"`
+	Relation  string     `json:"Relation Name"`
+	Schema    string     `json:"Schema"`
+	TotalCost float64    `json:"Total Cost"`
+	Plans     []planNode `json:"Plans"`
+}
+
+func (n planNode) walk(fn func(n planNode)) {
+	fn(n)
+
+	for _, child := range n.Plans {
+		child.walk(fn)
+	}
+}
+
+// seqScans returns the tables that are sequentially scanned by the node or
+// its children, sorted by name.
+func (n planNode) seqScans() []planTable {
+	var scans []planTable
+
+	n.walk(func(n planNode) {
+		table := planTable{Schema: n.Schema, Relation: n.Relation}
+
+		if n.NodeType == "Seq Scan" && !slices.Contains(scans, table) {
+			scans = append(scans, table)
+		}
+	})
+
+	slices.SortFunc(scans, func(a, b planTable) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	return scans
+}
+
+func estimatedRows(
+	ctx context.Context, conn *pgx.Conn, table planTable,
+) (int64, error) {
+	var rows int64
+
+	err := conn.QueryRow(ctx, `
+SELECT coalesce(max(reltuples), 0)::bigint
+FROM pg_class WHERE oid = to_regclass(quote_ident($1) || '.' || quote_ident($2))`,
+		table.Schema, table.Relation,
+	).Scan(&rows)
+	if err != nil {
+		return 0, fmt.Errorf("get estimated rows for %q: %w", table, err)
+	}
+
+	return rows, nil
+}
+
+func envInt(name string, defaultValue int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %w", name, err)
+	}
+
+	return n, nil
+}
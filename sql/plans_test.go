@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestPlanNodeSeqScans(t *testing.T) {
+	raw := []byte(`{
+  "Node Type": "Hash Join",
+  "Total Cost": 42.5,
+  "Plans": [
+    {
+      "Node Type": "Seq Scan",
+      "Relation Name": "document",
+      "Schema": "public",
+      "Total Cost": 20
+    },
+    {
+      "Node Type": "Hash",
+      "Plans": [
+        {
+          "Node Type": "Seq Scan",
+          "Relation Name": "document",
+          "Schema": "archive",
+          "Total Cost": 10
+        },
+        {
+          "Node Type": "Index Scan",
+          "Relation Name": "status",
+          "Schema": "public",
+          "Total Cost": 1
+        },
+        {
+          "Node Type": "Seq Scan",
+          "Relation Name": "document",
+          "Schema": "public",
+          "Total Cost": 20
+        }
+      ]
+    }
+  ]
+}`)
+
+	var root planNode
+
+	err := json.Unmarshal(raw, &root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []planTable{
+		{Schema: "archive", Relation: "document"},
+		{Schema: "public", Relation: "document"},
+	}
+
+	got := root.seqScans()
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,165 @@
+package sql
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// namedQuery is a query from a sqlc query file.
+type namedQuery struct {
+	Name    string
+	Command string
+	File    string
+	// Line is the line of the name comment.
+	Line int
+	// BodyLine is the line where the SQL starts.
+	BodyLine int
+	SQL      string
+}
+
+// id returns the name of the query qualified by its package, f.ex.
+// "postgres/documents.GetDocument", as query names only have to be unique
+// within a package.
+func (q namedQuery) id() string {
+	return filepath.ToSlash(filepath.Dir(q.File)) + "." + q.Name
+}
+
+var (
+	queryNameExp  = regexp.MustCompile(`^--\s*name:\s*(\S+)\s+(:\S+)`)
+	sqlcFuncExp   = regexp.MustCompile(`sqlc\.(arg|narg|slice)\(\s*'?"?([a-zA-Z_][a-zA-Z0-9_]*)"?'?\s*\)`)
+	sqlcEmbedExp  = regexp.MustCompile(`sqlc\.embed\(\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\)`)
+	atParamExp    = regexp.MustCompile(`(^|[^@<:\w])@([a-zA-Z_][a-zA-Z0-9_]*)`)
+	positionalExp = regexp.MustCompile(`\$([0-9]+)`)
+)
+
+// queryFiles returns the sqlc query files of the project.
+func queryFiles() ([]string, error) {
+	packages, err := sqlcPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, len(packages))
+
+	for i := range packages {
+		files[i] = packages[i].Queries
+	}
+
+	return files, nil
+}
+
+// parseQueryFile reads the named queries in a sqlc query file.
+func parseQueryFile(name string) ([]namedQuery, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open query file: %w", err)
+	}
+
+	defer f.Close()
+
+	var (
+		queries []namedQuery
+		current *namedQuery
+		body    strings.Builder
+		lineNo  int
+	)
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+
+		raw := body.String()
+		trimmed := strings.TrimLeft(raw, " \t\r\n")
+
+		current.BodyLine = current.Line + 1 +
+			strings.Count(raw[:len(raw)-len(trimmed)], "\n")
+		current.SQL = strings.TrimSpace(trimmed)
+		queries = append(queries, *current)
+
+		current = nil
+
+		body.Reset()
+	}
+
+	scan := bufio.NewScanner(f)
+
+	for scan.Scan() {
+		lineNo++
+
+		line := scan.Text()
+
+		m := queryNameExp.FindStringSubmatch(line)
+		if m != nil {
+			flush()
+
+			current = &namedQuery{
+				Name:    m[1],
+				Command: m[2],
+				File:    name,
+				Line:    lineNo,
+			}
+
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+
+	err = scan.Err()
+	if err != nil {
+		return nil, fmt.Errorf("read query file: %w", err)
+	}
+
+	flush()
+
+	return queries, nil
+}
+
+// positionalSQL rewrites sqlc named parameters to positional parameters so
+// that the query can be sent to the database.
+func positionalSQL(query string) string {
+	var next int
+
+	for _, m := range positionalExp.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(m[1])
+		next = max(next, n)
+	}
+
+	params := make(map[string]string)
+
+	param := func(name string) string {
+		p, ok := params[name]
+		if !ok {
+			next++
+			p = "$" + strconv.Itoa(next)
+			params[name] = p
+		}
+
+		return p
+	}
+
+	query = sqlcEmbedExp.ReplaceAllString(query, "$1.*")
+
+	query = sqlcFuncExp.ReplaceAllStringFunc(query, func(s string) string {
+		return param(sqlcFuncExp.FindStringSubmatch(s)[2])
+	})
+
+	query = atParamExp.ReplaceAllStringFunc(query, func(s string) string {
+		m := atParamExp.FindStringSubmatch(s)
+
+		return m[1] + param(m[2])
+	})
+
+	return strings.TrimSuffix(strings.TrimSpace(query), ";")
+}
@@ -0,0 +1,120 @@
+package sql
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPositionalSQL(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "positional",
+			query: "SELECT id FROM document WHERE uuid = $1;",
+			want:  "SELECT id FROM document WHERE uuid = $1",
+		},
+		{
+			name:  "named",
+			query: "SELECT id FROM document WHERE uuid = @uuid AND type = @type",
+			want:  "SELECT id FROM document WHERE uuid = $1 AND type = $2",
+		},
+		{
+			name:  "repeated names",
+			query: "SELECT @a::int + @b::int + @a::int",
+			want:  "SELECT $1::int + $2::int + $1::int",
+		},
+		{
+			name:  "sqlc functions",
+			query: "SELECT * FROM t WHERE a = sqlc.arg(a) AND b = sqlc.narg('b') AND c = ANY(sqlc.slice(\"c\")) AND d = @a",
+			want:  "SELECT * FROM t WHERE a = $1 AND b = $2 AND c = ANY($3) AND d = $1",
+		},
+		{
+			name:  "after positional",
+			query: "SELECT $2, @name, $1",
+			want:  "SELECT $2, $3, $1",
+		},
+		{
+			name:  "embed",
+			query: "SELECT sqlc.embed(d) FROM document AS d",
+			want:  "SELECT d.* FROM document AS d",
+		},
+		{
+			name:  "operators and casts",
+			query: "SELECT a @> b, c <@ d, e::text, 'x@y' FROM t",
+			want:  "SELECT a @> b, c <@ d, e::text, 'x@y' FROM t",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := positionalSQL(c.query)
+			if got != c.want {
+				t.Fatalf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestParseQueryFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "queries.sql")
+
+	err := os.WriteFile(name, []byte(`-- Queries for documents.
+
+-- name: GetDocument :one
+SELECT id, title
+FROM document
+WHERE id = @id;
+
+-- name: ListDocuments :many
+
+-- A comment before the query.
+SELECT id FROM document
+LIMIT 10;
+-- name: DeleteDocument :exec
+DELETE FROM document WHERE id = $1;
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parseQueryFile(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []namedQuery{
+		{
+			Name:     "GetDocument",
+			Command:  ":one",
+			File:     name,
+			Line:     3,
+			BodyLine: 4,
+			SQL:      "SELECT id, title\nFROM document\nWHERE id = @id;",
+		},
+		{
+			Name:     "ListDocuments",
+			Command:  ":many",
+			File:     name,
+			Line:     8,
+			BodyLine: 10,
+			SQL:      "-- A comment before the query.\nSELECT id FROM document\nLIMIT 10;",
+		},
+		{
+			Name:     "DeleteDocument",
+			Command:  ":exec",
+			File:     name,
+			Line:     13,
+			BodyLine: 14,
+			SQL:      "DELETE FROM document WHERE id = $1;",
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %#v, got %#v", want, got)
+	}
+}
@@ -0,0 +1,616 @@
+package sql
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/mage/internal"
+)
+
+// CreatePublication creates a publication for the tables in the comma
+// separated list, or for all tables if the list is empty.
+func CreatePublication(ctx context.Context, name string, tables string) error {
+	conn, err := replicationConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	target := "ALL TABLES"
+
+	if strings.TrimSpace(tables) != "" {
+		var idents []string
+
+		for _, t := range strings.Split(tables, ",") {
+			idents = append(idents, quoteQualified(strings.TrimSpace(t)))
+		}
+
+		target = "TABLE " + strings.Join(idents, ", ")
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf("CREATE PUBLICATION %s FOR %s",
+		quoteIdentifier(name), target))
+	if err != nil {
+		return fmt.Errorf("create publication: %w", err)
+	}
+
+	return nil
+}
+
+// DropPublication drops a publication if it exists.
+func DropPublication(ctx context.Context, name string) error {
+	conn, err := replicationConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "DROP PUBLICATION IF EXISTS "+quoteIdentifier(name))
+	if err != nil {
+		return fmt.Errorf("drop publication: %w", err)
+	}
+
+	return nil
+}
+
+// CreateSlot creates a logical replication slot using an output plugin:
+// "pgoutput", "test_decoding", or "wal2json" if it's installed.
+func CreateSlot(ctx context.Context, name string, plugin string) error {
+	conn, err := replicationConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx,
+		"SELECT pg_create_logical_replication_slot($1, $2)", name, plugin)
+	if err != nil {
+		return fmt.Errorf("create replication slot: %w", err)
+	}
+
+	return nil
+}
+
+// DropSlot drops a replication slot.
+func DropSlot(ctx context.Context, name string) error {
+	conn, err := replicationConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "SELECT pg_drop_replication_slot($1)", name)
+	if err != nil {
+		return fmt.Errorf("drop replication slot: %w", err)
+	}
+
+	return nil
+}
+
+// Slots lists the replication slots with their lag, the amount of WAL
+// between the current position and what the consumer has confirmed, and the
+// size of the WAL that is retained for the slot.
+func Slots(ctx context.Context) error {
+	conn, err := replicationConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `
+SELECT slot_name, coalesce(plugin, ''), slot_type, coalesce(database, ''),
+       active,
+       coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn), 0)::bigint,
+       coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint
+FROM pg_replication_slots
+ORDER BY slot_name`)
+	if err != nil {
+		return fmt.Errorf("list replication slots: %w", err)
+	}
+
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "SLOT\tPLUGIN\tTYPE\tDATABASE\tACTIVE\tLAG\tRETAINED")
+
+	for rows.Next() {
+		var (
+			name, plugin, slotType, database string
+			active                           bool
+			lag, retained                    int64
+		)
+
+		err := rows.Scan(&name, &plugin, &slotType, &database,
+			&active, &lag, &retained)
+		if err != nil {
+			return fmt.Errorf("read replication slot: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+			name, plugin, slotType, database, active,
+			internal.FormatBytes(lag), internal.FormatBytes(retained))
+	}
+
+	if rows.Err() != nil {
+		return fmt.Errorf("list replication slots: %w", rows.Err())
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("write slot list: %w", err)
+	}
+
+	return nil
+}
+
+// tailBatchSize is the maximum number of changes that are read at a time.
+const tailBatchSize = 1000
+
+// Tail prints the decoded changes in the database using the output plugin of
+// a logical replication slot until interrupted. The changes are read through
+// a temporary slot that is dropped when the target exits, so the slot isn't
+// advanced and can be in use by its consumer while it's tailed. Only changes
+// that are committed after the target has been started are printed. The
+// publication is only used with pgoutput slots, where the changes are
+// printed as JSON.
+func Tail(ctx context.Context, slot string, publication string) error {
+	conn, err := replicationConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(ctx)
+
+	var plugin string
+
+	err = conn.QueryRow(ctx,
+		"SELECT plugin FROM pg_replication_slots WHERE slot_name = $1",
+		slot).Scan(&plugin)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("no replication slot named %q", slot)
+	} else if err != nil {
+		return fmt.Errorf("get replication slot: %w", err)
+	}
+
+	if plugin == "pgoutput" && publication == "" {
+		return errors.New("a publication is required for pgoutput slots")
+	}
+
+	tailSlot, err := randomName("tail_")
+	if err != nil {
+		return fmt.Errorf("generate slot name: %w", err)
+	}
+
+	// Temporary slots are dropped when the session ends.
+	_, err = conn.Exec(ctx,
+		"SELECT pg_create_logical_replication_slot($1, $2, true)",
+		tailSlot, plugin)
+	if err != nil {
+		return fmt.Errorf("create temporary replication slot: %w", err)
+	}
+
+	decoder := newPgoutputDecoder()
+
+	for {
+		var (
+			n   int
+			err error
+		)
+
+		if plugin == "pgoutput" {
+			n, err = tailPgoutput(ctx, conn, tailSlot, publication,
+				decoder)
+		} else {
+			n, err = tailText(ctx, conn, tailSlot)
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Read the next batch right away if there are more changes.
+		if n >= tailBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// tailText prints the changes from a slot with a text output plugin and
+// returns the number of changes that were read.
+func tailText(ctx context.Context, conn *pgx.Conn, slot string) (int, error) {
+	rows, err := conn.Query(ctx, `
+SELECT lsn::text, data
+FROM pg_logical_slot_get_changes($1, NULL, $2)`, slot, tailBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("get changes: %w", err)
+	}
+
+	defer rows.Close()
+
+	var n int
+
+	for rows.Next() {
+		var lsn, data string
+
+		err := rows.Scan(&lsn, &data)
+		if err != nil {
+			return n, fmt.Errorf("read change: %w", err)
+		}
+
+		n++
+
+		fmt.Printf("%s %s\n", lsn, data)
+	}
+
+	if rows.Err() != nil {
+		return n, fmt.Errorf("get changes: %w", rows.Err())
+	}
+
+	return n, nil
+}
+
+// tailPgoutput prints the decoded changes from a pgoutput slot and returns
+// the number of messages that were read.
+func tailPgoutput(
+	ctx context.Context, conn *pgx.Conn, slot string, publication string,
+	decoder *pgoutputDecoder,
+) (int, error) {
+	rows, err := conn.Query(ctx, `
+SELECT lsn::text, data
+FROM pg_logical_slot_get_binary_changes($1, NULL, $2,
+     'proto_version', '1', 'publication_names', $3)`,
+		slot, tailBatchSize, publication)
+	if err != nil {
+		return 0, fmt.Errorf("get changes: %w", err)
+	}
+
+	defer rows.Close()
+
+	var n int
+
+	for rows.Next() {
+		var (
+			lsn  string
+			data []byte
+		)
+
+		err := rows.Scan(&lsn, &data)
+		if err != nil {
+			return n, fmt.Errorf("read change: %w", err)
+		}
+
+		n++
+
+		change, err := decoder.decode(data)
+		if err != nil {
+			return n, fmt.Errorf("decode change at %s: %w", lsn, err)
+		}
+
+		if change == nil {
+			continue
+		}
+
+		change.LSN = lsn
+
+		out, err := json.Marshal(change)
+		if err != nil {
+			return n, fmt.Errorf("marshal change: %w", err)
+		}
+
+		fmt.Println(string(out))
+	}
+
+	if rows.Err() != nil {
+		return n, fmt.Errorf("get changes: %w", rows.Err())
+	}
+
+	return n, nil
+}
+
+// replicationConn connects to the project database with the admin role when
+// it's on the local Postgres instance, as replication requires elevated
+// privileges.
+func replicationConn(ctx context.Context) (*pgx.Conn, error) {
+	err := ensurePostgres(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := GetConnInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	connString := info.Full()
+
+	if isLocalHost(info.Host) {
+		connString = adminConnString + "/" + info.Database
+	}
+
+	conn, err := connect(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	return conn, nil
+}
+
+func quoteQualified(name string) string {
+	parts := strings.Split(name, ".")
+
+	for i := range parts {
+		parts[i] = quoteIdentifier(parts[i])
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// pgChange is a decoded pgoutput change.
+type pgChange struct {
+	LSN   string         `json:"lsn"`
+	Op    string         `json:"op"`
+	XID   uint32         `json:"xid,omitempty"`
+	Table string         `json:"table,omitempty"`
+	New   map[string]any `json:"new,omitempty"`
+	Old   map[string]any `json:"old,omitempty"`
+}
+
+type pgRelation struct {
+	Name    string
+	Columns []string
+}
+
+// pgoutputDecoder is a minimal decoder for version 1 of the pgoutput
+// protocol. Values are left in their text representation.
+type pgoutputDecoder struct {
+	relations map[uint32]pgRelation
+}
+
+func newPgoutputDecoder() *pgoutputDecoder {
+	return &pgoutputDecoder{
+		relations: make(map[uint32]pgRelation),
+	}
+}
+
+// decode decodes a pgoutput message, returning nil for messages that aren't
+// printed.
+func (d *pgoutputDecoder) decode(data []byte) (*pgChange, error) {
+	r := &pgReader{data: data}
+
+	switch r.byte() {
+	case 'B':
+		_ = r.uint64() // Final LSN.
+		_ = r.uint64() // Commit timestamp.
+
+		return &pgChange{Op: "begin", XID: r.uint32()}, r.err
+	case 'C':
+		return &pgChange{Op: "commit"}, r.err
+	case 'R':
+		id := r.uint32()
+		namespace := r.string()
+		name := r.string()
+
+		_ = r.byte() // Replica identity.
+
+		rel := pgRelation{Name: namespace + "." + name}
+
+		n := int(r.uint16())
+
+		for i := 0; i < n && r.err == nil; i++ {
+			_ = r.byte() // Flags.
+
+			rel.Columns = append(rel.Columns, r.string())
+
+			_ = r.uint32() // Type OID.
+			_ = r.uint32() // Type modifier.
+		}
+
+		d.relations[id] = rel
+
+		return nil, r.err
+	case 'I':
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+
+		_ = r.byte() // 'N'
+
+		return &pgChange{
+			Op: "insert", Table: rel.Name,
+			New: r.tuple(rel),
+		}, r.err
+	case 'U':
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+
+		change := pgChange{Op: "update", Table: rel.Name}
+
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			change.Old = r.tuple(rel)
+
+			kind = r.byte()
+		}
+
+		if kind == 'N' {
+			change.New = r.tuple(rel)
+		}
+
+		return &change, r.err
+	case 'D':
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+
+		_ = r.byte() // 'K' or 'O'
+
+		return &pgChange{
+			Op: "delete", Table: rel.Name,
+			Old: r.tuple(rel),
+		}, r.err
+	case 'T':
+		n := int(r.uint32())
+
+		_ = r.byte() // Options.
+
+		var tables []string
+
+		for i := 0; i < n && r.err == nil; i++ {
+			rel, err := d.relation(r.uint32())
+			if err != nil {
+				return nil, err
+			}
+
+			tables = append(tables, rel.Name)
+		}
+
+		return &pgChange{
+			Op: "truncate", Table: strings.Join(tables, ","),
+		}, r.err
+	}
+
+	// Type, origin, and logical decoding messages aren't printed.
+	return nil, r.err
+}
+
+func (d *pgoutputDecoder) relation(id uint32) (pgRelation, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return pgRelation{}, fmt.Errorf("unknown relation %d", id)
+	}
+
+	return rel, nil
+}
+
+// pgReader reads pgoutput message fields, the first error is kept and
+// subsequent reads return zero values.
+type pgReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if len(r.data) < n {
+		r.err = errors.New("message is truncated")
+
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+
+	return b
+}
+
+func (r *pgReader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (r *pgReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *pgReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *pgReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *pgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+
+	i := strings.IndexByte(string(r.data), 0)
+	if i < 0 {
+		r.err = errors.New("unterminated string")
+
+		return ""
+	}
+
+	s := string(r.data[:i])
+	r.data = r.data[i+1:]
+
+	return s
+}
+
+// tuple reads tuple data. Unchanged TOAST values are omitted.
+func (r *pgReader) tuple(rel pgRelation) map[string]any {
+	n := int(r.uint16())
+	values := make(map[string]any, n)
+
+	for i := 0; i < n && r.err == nil; i++ {
+		name := fmt.Sprintf("column_%d", i+1)
+		if i < len(rel.Columns) {
+			name = rel.Columns[i]
+		}
+
+		switch r.byte() {
+		case 'n':
+			values[name] = nil
+		case 't':
+			length := int(r.uint32())
+
+			values[name] = string(r.next(length))
+		case 'u':
+		default:
+			r.err = errors.New("unknown tuple value kind")
+		}
+	}
+
+	return values
+}
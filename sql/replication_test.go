@@ -0,0 +1,140 @@
+package sql
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// pgMessage builds a pgoutput message from bytes, integers, strings, and
+// nested byte slices.
+func pgMessage(parts ...any) []byte {
+	var b []byte
+
+	for _, p := range parts {
+		switch v := p.(type) {
+		case byte:
+			b = append(b, v)
+		case uint16:
+			b = binary.BigEndian.AppendUint16(b, v)
+		case uint32:
+			b = binary.BigEndian.AppendUint32(b, v)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(b, v)
+		case string:
+			b = append(append(b, v...), 0)
+		case []byte:
+			b = append(b, v...)
+		}
+	}
+
+	return b
+}
+
+func pgText(v string) []byte {
+	return pgMessage(byte('t'), uint32(len(v)), []byte(v))
+}
+
+func TestPgoutputDecoder(t *testing.T) {
+	relation := pgMessage(byte('R'), uint32(16384), "public", "document",
+		byte('d'), uint16(2),
+		byte(1), "id", uint32(23), uint32(0xffffffff),
+		byte(0), "title", uint32(25), uint32(0xffffffff),
+	)
+
+	cases := []struct {
+		name string
+		data []byte
+		want *pgChange
+		err  string
+	}{
+		{
+			name: "begin",
+			data: pgMessage(byte('B'), uint64(1), uint64(2), uint32(731)),
+			want: &pgChange{Op: "begin", XID: 731},
+		},
+		{
+			name: "commit",
+			data: pgMessage(byte('C'), byte(0), uint64(1), uint64(2), uint64(3)),
+			want: &pgChange{Op: "commit"},
+		},
+		{
+			name: "insert",
+			data: pgMessage(byte('I'), uint32(16384), byte('N'), uint16(2),
+				pgText("1"), pgText("Hello")),
+			want: &pgChange{
+				Op: "insert", Table: "public.document",
+				New: map[string]any{"id": "1", "title": "Hello"},
+			},
+		},
+		{
+			name: "update with key",
+			data: pgMessage(byte('U'), uint32(16384),
+				byte('K'), uint16(2), pgText("1"), byte('n'),
+				byte('N'), uint16(2), pgText("2"), byte('u')),
+			want: &pgChange{
+				Op: "update", Table: "public.document",
+				Old: map[string]any{"id": "1", "title": nil},
+				New: map[string]any{"id": "2"},
+			},
+		},
+		{
+			name: "delete",
+			data: pgMessage(byte('D'), uint32(16384),
+				byte('K'), uint16(1), pgText("1")),
+			want: &pgChange{
+				Op: "delete", Table: "public.document",
+				Old: map[string]any{"id": "1"},
+			},
+		},
+		{
+			name: "truncate",
+			data: pgMessage(byte('T'), uint32(1), byte(0), uint32(16384)),
+			want: &pgChange{Op: "truncate", Table: "public.document"},
+		},
+		{
+			name: "origin",
+			data: pgMessage(byte('O'), uint64(1), "origin"),
+		},
+		{
+			name: "unknown relation",
+			data: pgMessage(byte('I'), uint32(1), byte('N'), uint16(0)),
+			err:  "unknown relation 1",
+		},
+		{
+			name: "truncated message",
+			data: pgMessage(byte('I'), uint32(16384), byte('N'), uint16(1),
+				byte('t'), uint32(10), []byte("abc")),
+			err: "message is truncated",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := newPgoutputDecoder()
+
+			change, err := d.decode(relation)
+			if err != nil || change != nil {
+				t.Fatalf("decode relation: %v, %v", change, err)
+			}
+
+			got, err := d.decode(c.data)
+
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package sql
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/mage/internal"
+)
+
+// Seed loads the fixture files in "./postgres/seed" into the database.
+//
+// CSV and JSON files are named after the table they populate, f.ex.
+// "documents.csv" or "archive.documents.json", and are loaded in foreign key
+// dependency order. Rows that conflict with existing rows are skipped, so
+// seeding can safely be run repeatedly. SQL files are executed after the data
+// files in lexical order, and should be written to be idempotent.
+//
+// Everything is loaded in a single transaction.
+func Seed(ctx context.Context) error {
+	err := ensurePostgres(ctx)
+	if err != nil {
+		return err
+	}
+
+	return SeedFromDir(ctx, MustGetConnString(),
+		filepath.Join("postgres", "seed"))
+}
+
+// Reset drops and recreates the project database, and then runs the
+// migrations and loads the seed data. The database must be on the local
+// Postgres instance.
+func Reset(ctx context.Context) error {
+	info, err := localConnInfo("reset")
+	if err != nil {
+		return err
+	}
+
+	err = DropDBWithName(info.Database)
+	if err != nil {
+		return fmt.Errorf("drop database: %w", err)
+	}
+
+	err = DBWithName(info.Database)
+	if err != nil {
+		return fmt.Errorf("create database: %w", err)
+	}
+
+	err = Migrate()
+	if err != nil {
+		return fmt.Errorf("migrate database: %w", err)
+	}
+
+	err = Seed(ctx)
+	if err != nil {
+		return fmt.Errorf("seed database: %w", err)
+	}
+
+	return nil
+}
+
+// SeedFromDir loads the fixture files in dir into the database, see Seed for
+// details.
+func SeedFromDir(ctx context.Context, connString string, dir string) error {
+	exists, err := internal.DirectoryExists(dir)
+	if err != nil {
+		return fmt.Errorf("check for seed directory: %w", err)
+	}
+
+	if !exists {
+		fmt.Printf("no seed directory %q, nothing to load\n", dir)
+
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("list seed files: %w", err)
+	}
+
+	var (
+		tableFiles = make(map[string]string)
+		sqlFiles   []string
+	)
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		name := e.Name()
+		ext := filepath.Ext(name)
+
+		switch ext {
+		case ".sql":
+			sqlFiles = append(sqlFiles, filepath.Join(dir, name))
+		case ".csv", ".json":
+			table := strings.TrimSuffix(name, ext)
+
+			if _, dup := tableFiles[table]; dup {
+				return fmt.Errorf(
+					"more than one seed file for the table %q", table)
+			}
+
+			tableFiles[table] = filepath.Join(dir, name)
+		}
+	}
+
+	slices.Sort(sqlFiles)
+
+	conn, err := connect(ctx, connString)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tables, err := resolveTables(ctx, tx, tableFiles)
+	if err != nil {
+		return err
+	}
+
+	order, err := dependencyOrder(ctx, tx, tables)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range order {
+		file := tables[table]
+
+		columns, rows, err := readSeedFile(file)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", file, err)
+		}
+
+		n, err := insertRows(ctx, tx, table, columns, rows, false)
+		if err != nil {
+			return fmt.Errorf("load %q: %w", file, err)
+		}
+
+		fmt.Printf("%s: inserted %d of %d rows\n", table, n, len(rows))
+	}
+
+	for _, file := range sqlFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", file, err)
+		}
+
+		_, err = tx.Exec(ctx, string(data))
+		if err != nil {
+			return fmt.Errorf("execute %q: %w", file, err)
+		}
+
+		fmt.Printf("%s: executed\n", file)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// resolveTables resolves the table names used by the seed files to their
+// canonical names, as used by the system catalog.
+func resolveTables(
+	ctx context.Context, tx pgx.Tx, tableFiles map[string]string,
+) (map[string]string, error) {
+	tables := make(map[string]string, len(tableFiles))
+
+	for name, file := range tableFiles {
+		var canonical string
+
+		err := tx.QueryRow(ctx,
+			"SELECT coalesce(to_regclass($1)::text, '')", name,
+		).Scan(&canonical)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"resolve table %q for %q: %w", name, file, err)
+		}
+
+		if canonical == "" {
+			return nil, fmt.Errorf(
+				"the table %q for %q doesn't exist", name, file)
+		}
+
+		tables[canonical] = file
+	}
+
+	return tables, nil
+}
+
+// dependencyOrder sorts the tables so that tables come after the tables they
+// reference through foreign keys.
+func dependencyOrder(
+	ctx context.Context, tx pgx.Tx, tables map[string]string,
+) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+SELECT conrelid::regclass::text, confrelid::regclass::text
+FROM pg_constraint
+WHERE contype = 'f' AND conrelid <> confrelid`)
+	if err != nil {
+		return nil, fmt.Errorf("list foreign keys: %w", err)
+	}
+
+	deps := make(map[string][]string)
+
+	for rows.Next() {
+		var table, references string
+
+		err := rows.Scan(&table, &references)
+		if err != nil {
+			return nil, fmt.Errorf("read foreign key: %w", err)
+		}
+
+		deps[table] = append(deps[table], references)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("list foreign keys: %w", rows.Err())
+	}
+
+	names := make([]string, 0, len(tables))
+
+	for name := range tables {
+		names = append(names, name)
+	}
+
+	return topoSort(names, deps)
+}
+
+// topoSort orders the names so that each name comes after its dependencies,
+// dependencies that aren't in names are ignored. Names without dependencies
+// between them are sorted lexically.
+func topoSort(names []string, deps map[string][]string) ([]string, error) {
+	slices.Sort(names)
+
+	var (
+		order   []string
+		done    = make(map[string]bool, len(names))
+		visited = make(map[string]bool, len(names))
+		wanted  = make(map[string]bool, len(names))
+		visit   func(name string, path []string) error
+	)
+
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+
+		if visited[name] {
+			return fmt.Errorf("circular dependency: %s",
+				strings.Join(append(path, name), " -> "))
+		}
+
+		visited[name] = true
+
+		for _, dep := range deps[name] {
+			if !wanted[dep] {
+				continue
+			}
+
+			err := visit(dep, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+
+		done[name] = true
+		order = append(order, name)
+
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// readSeedFile reads the rows of a CSV or JSON seed file. Values are returned
+// as text, nil values represent NULL.
+func readSeedFile(name string) ([]string, [][]any, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open file: %w", err)
+	}
+
+	defer f.Close()
+
+	switch filepath.Ext(name) {
+	case ".csv":
+		return readSeedCSV(f)
+	case ".json":
+		return readSeedJSON(f)
+	}
+
+	return nil, nil, errors.New("unsupported seed file type")
+}
+
+// readSeedCSV reads a CSV file with a header row. Empty values are treated as
+// NULL.
+func readSeedCSV(r io.Reader) ([]string, [][]any, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CSV: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("missing header row")
+	}
+
+	columns := records[0]
+	rows := make([][]any, len(records)-1)
+
+	for i, record := range records[1:] {
+		row := make([]any, len(record))
+
+		for j := range record {
+			if record[j] != "" {
+				row[j] = record[j]
+			}
+		}
+
+		rows[i] = row
+	}
+
+	return columns, rows, nil
+}
+
+// seedDefault is used as the value of columns that are missing from a JSON
+// object, so that the column default is used instead of NULL.
+type seedDefault struct{}
+
+// readSeedJSON reads a JSON array of objects. Objects and arrays are stored as
+// their JSON representation. Keys that are missing from an object are inserted
+// as DEFAULT.
+func readSeedJSON(r io.Reader) ([]string, [][]any, error) {
+	dec := json.NewDecoder(r)
+
+	dec.UseNumber()
+
+	var objects []map[string]any
+
+	err := dec.Decode(&objects)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse JSON: %w", err)
+	}
+
+	var columns []string
+
+	seen := make(map[string]bool)
+
+	for _, obj := range objects {
+		for k := range obj {
+			if seen[k] {
+				continue
+			}
+
+			seen[k] = true
+			columns = append(columns, k)
+		}
+	}
+
+	slices.Sort(columns)
+
+	rows := make([][]any, len(objects))
+
+	for i, obj := range objects {
+		row := make([]any, len(columns))
+
+		for j, col := range columns {
+			value, ok := obj[col]
+			if !ok {
+				row[j] = seedDefault{}
+
+				continue
+			}
+
+			v, err := jsonSeedValue(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf(
+					"row %d column %q: %w", i, col, err)
+			}
+
+			row[j] = v
+		}
+
+		rows[i] = row
+	}
+
+	return columns, rows, nil
+}
+
+func jsonSeedValue(v any) (any, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	case bool:
+		if val {
+			return "true", nil
+		}
+
+		return "false", nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal value: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// insertRows inserts text values into a table, skipping rows that conflict
+// with existing rows. The simple protocol is used so that the values are sent
+// as untyped literals and get coerced to the column types by the server.
+// Values of the type seedDefault are inserted as DEFAULT. Set overrideIdentity
+// to insert the values of identity columns that are generated always.
+func insertRows(
+	ctx context.Context, tx pgx.Tx,
+	table string, columns []string, rows [][]any, overrideIdentity bool,
+) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	quoted := make([]string, len(columns))
+
+	for i := range columns {
+		quoted[i] = quoteIdentifier(columns[i])
+	}
+
+	var inserted int64
+
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return inserted, fmt.Errorf(
+				"row %d: expected %d values, got %d",
+				i, len(columns), len(row))
+		}
+
+		query, args := insertRowQuery(table, quoted, row, overrideIdentity)
+
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return inserted, fmt.Errorf("insert row %d: %w", i, err)
+		}
+
+		inserted += tag.RowsAffected()
+	}
+
+	return inserted, nil
+}
+
+// insertRowQuery builds the insert statement and arguments for a single row.
+func insertRowQuery(
+	table string, quoted []string, row []any, overrideIdentity bool,
+) (string, []any) {
+	var (
+		values = make([]string, len(row))
+		args   = []any{pgx.QueryExecModeSimpleProtocol}
+	)
+
+	for i, v := range row {
+		if _, ok := v.(seedDefault); ok {
+			values[i] = "DEFAULT"
+
+			continue
+		}
+
+		args = append(args, v)
+		values[i] = fmt.Sprintf("$%d", len(args)-1)
+	}
+
+	var overriding string
+
+	if overrideIdentity {
+		overriding = " OVERRIDING SYSTEM VALUE"
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s)%s VALUES (%s) ON CONFLICT DO NOTHING",
+		table,
+		strings.Join(quoted, ", "),
+		overriding,
+		strings.Join(values, ", "),
+	)
+
+	return query, args
+}
@@ -0,0 +1,340 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/magefile/mage/sh"
+	"github.com/ttab/mage/ia"
+	"github.com/ttab/mage/internal"
+)
+
+var snapshotLabelExp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Snapshot dumps the database to a named snapshot in the state directory.
+// An existing snapshot with the same label will be replaced.
+func Snapshot(label string) error {
+	err := ensurePostgres(context.Background())
+	if err != nil {
+		return err
+	}
+
+	info, err := GetConnInfo()
+	if err != nil {
+		return err
+	}
+
+	dir, err := snapshotDir(info)
+	if err != nil {
+		return err
+	}
+
+	err = validateSnapshotLabel(label)
+	if err != nil {
+		return err
+	}
+
+	err = internal.EnsureDirectory(dir)
+	if err != nil {
+		return err
+	}
+
+	connString, env := toolConn(info)
+
+	err = pgTool(dir, env, "pg_dump", connString,
+		"--format=custom",
+		"--file", "/snapshots/"+label+".dump",
+	)
+	if err != nil {
+		return fmt.Errorf("run pg_dump: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces the database with a named snapshot. The snapshot is
+// restored into a temporary database that replaces the database once the
+// restore has succeeded, so a failed restore leaves the database as it was.
+// The login role is left as it is. The database must be on the local
+// Postgres instance.
+func Restore(label string) error {
+	ctx := context.Background()
+
+	err := ensurePostgres(ctx)
+	if err != nil {
+		return err
+	}
+
+	info, err := localConnInfo("restore")
+	if err != nil {
+		return err
+	}
+
+	dir, err := snapshotDir(info)
+	if err != nil {
+		return err
+	}
+
+	err = validateSnapshotLabel(label)
+	if err != nil {
+		return err
+	}
+
+	exists, err := internal.FileExists(filepath.Join(dir, label+".dump"))
+	if err != nil {
+		return fmt.Errorf("check for snapshot: %w", err)
+	}
+
+	if !exists {
+		return fmt.Errorf("no snapshot named %q", label)
+	}
+
+	name := info.Database
+
+	ok, err := ia.Confirm(fmt.Sprintf(
+		"Replace the database %q with the snapshot %q, terminating any active connections",
+		name, label))
+	if err != nil {
+		return fmt.Errorf("confirm restore: %w", err)
+	}
+
+	if !ok {
+		return errors.New("restore cancelled")
+	}
+
+	// Make sure that the login role that will own the restored database
+	// exists.
+	err = CreateDB(ctx, name, DBOptions{})
+	if err != nil {
+		return fmt.Errorf("create database: %w", err)
+	}
+
+	tmpName := restoreDBName(name, "_restore")
+	oldName := restoreDBName(name, "_replaced")
+
+	tmpInfo, err := info.withDatabase(tmpName)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connect(ctx, adminConnString)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	// Clean up after a previously failed attempt.
+	for _, db := range []string{tmpName, oldName} {
+		_, err = conn.Exec(ctx, fmt.Sprintf(
+			"DROP DATABASE IF EXISTS %s WITH (FORCE)",
+			quoteIdentifier(db)))
+		if err != nil {
+			return fmt.Errorf("drop old database %q: %w", db, err)
+		}
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"CREATE DATABASE %s WITH OWNER %s",
+		quoteIdentifier(tmpName), quoteIdentifier(name),
+	))
+	if err != nil {
+		return fmt.Errorf("create restore database: %w", err)
+	}
+
+	connString, env := toolConn(tmpInfo)
+
+	err = pgTool(dir, env, "pg_restore",
+		"--dbname", connString,
+		"--no-owner", "--no-privileges",
+		"/snapshots/"+label+".dump",
+	)
+	if err != nil {
+		_, _ = conn.Exec(ctx, fmt.Sprintf(
+			"DROP DATABASE IF EXISTS %s WITH (FORCE)",
+			quoteIdentifier(tmpName)))
+
+		return fmt.Errorf("run pg_restore: %w", err)
+	}
+
+	err = swapDatabases(ctx, conn, name, tmpName, oldName)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"DROP DATABASE %s WITH (FORCE)", quoteIdentifier(oldName)))
+	if err != nil {
+		return fmt.Errorf("drop replaced database %q: %w", oldName, err)
+	}
+
+	return nil
+}
+
+// swapDatabases moves the database aside and renames the restored database
+// into its place. The database is moved back if the rename fails.
+func swapDatabases(
+	ctx context.Context, conn *pgx.Conn,
+	name string, restored string, replaced string,
+) error {
+	// Databases can't be renamed while there are connections to them.
+	_, err := conn.Exec(ctx, `
+SELECT pg_terminate_backend(pid)
+FROM pg_stat_activity
+WHERE datname = $1 AND pid <> pg_backend_pid()`, name)
+	if err != nil {
+		return fmt.Errorf("terminate connections: %w", err)
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"ALTER DATABASE %s RENAME TO %s",
+		quoteIdentifier(name), quoteIdentifier(replaced),
+	))
+	if err != nil {
+		return fmt.Errorf("move database aside: %w", err)
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"ALTER DATABASE %s RENAME TO %s",
+		quoteIdentifier(restored), quoteIdentifier(name),
+	))
+	if err != nil {
+		_, rErr := conn.Exec(ctx, fmt.Sprintf(
+			"ALTER DATABASE %s RENAME TO %s",
+			quoteIdentifier(replaced), quoteIdentifier(name),
+		))
+		if rErr != nil {
+			return fmt.Errorf(
+				"rename restored database: %w, and move %q back: %w",
+				err, replaced, rErr)
+		}
+
+		return fmt.Errorf("rename restored database: %w", err)
+	}
+
+	return nil
+}
+
+// restoreDBName returns the name of a temporary database that is used when
+// restoring a snapshot of the database.
+func restoreDBName(name string, suffix string) string {
+	if len(name)+len(suffix) > 63 {
+		name = name[:63-len(suffix)]
+	}
+
+	return name + suffix
+}
+
+// Snapshots lists the snapshots of the database.
+func Snapshots() error {
+	info, err := GetConnInfo()
+	if err != nil {
+		return err
+	}
+
+	dir, err := snapshotDir(info)
+	if err != nil {
+		return err
+	}
+
+	exists, err := internal.DirectoryExists(dir)
+	if err != nil {
+		return fmt.Errorf("check for snapshot directory: %w", err)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("list snapshot directory: %w", err)
+	}
+
+	var infos []os.FileInfo
+
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".dump" {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("stat snapshot %q: %w", e.Name(), err)
+		}
+
+		infos = append(infos, info)
+	}
+
+	// List the most recent snapshots first.
+	slices.SortFunc(infos, func(a, b os.FileInfo) int {
+		return b.ModTime().Compare(a.ModTime())
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "LABEL\tSIZE\tCREATED")
+
+	for _, info := range infos {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n",
+			strings.TrimSuffix(info.Name(), ".dump"),
+			internal.FormatBytes(info.Size()),
+			info.ModTime().Format("2006-01-02 15:04:05"),
+		)
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("write snapshot list: %w", err)
+	}
+
+	return nil
+}
+
+func validateSnapshotLabel(label string) error {
+	if !snapshotLabelExp.MatchString(label) {
+		return errors.New("snapshot label must start with a letter or digit and only contain the characters a-z, A-Z, 0-9, '_', '.', or '-'")
+	}
+
+	return nil
+}
+
+// snapshotDir returns the snapshot directory for the database.
+func snapshotDir(info *ConnInfo) (string, error) {
+	stateDir, err := internal.StateDir()
+	if err != nil {
+		return "", fmt.Errorf("get state directory path: %w", err)
+	}
+
+	if info.Database == "" {
+		return "", errors.New("no database in connection string")
+	}
+
+	return filepath.Join(stateDir, "snapshots", info.Database), nil
+}
+
+// pgTool runs a postgres client tool in docker with host networking and the
+// snapshot directory mounted as "/snapshots". PGPASSWORD is passed on from env
+// if set.
+func pgTool(snapshotDir string, env map[string]string, args ...string) error {
+	uid := os.Getuid()
+	gid := os.Getgid()
+
+	dockerArgs := []string{
+		"run", "--rm", "--network", "host",
+		"--user", fmt.Sprintf("%d:%d", uid, gid),
+		"-v", fmt.Sprintf("%s:/snapshots", snapshotDir),
+		"-e", "PGPASSWORD",
+		postgresImage,
+	}
+
+	return sh.RunWith(env, "docker", append(dockerArgs, args...)...)
+}
@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ttab/mage/ia"
+)
+
+func TestValidateDBName(t *testing.T) {
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "documents", valid: true},
+		{name: "_documents", valid: true},
+		{name: "my-repo.v2", valid: true},
+		{name: "", valid: false},
+		{name: "..", valid: false},
+		{name: ".hidden", valid: false},
+		{name: "1st", valid: false},
+		{name: "a/b", valid: false},
+		{name: "a b", valid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateDBName(c.name)
+			if c.valid && err != nil {
+				t.Fatalf("expected %q to be valid: %v", c.name, err)
+			}
+
+			if !c.valid && err == nil {
+				t.Fatalf("expected %q to be invalid", c.name)
+			}
+		})
+	}
+}
+
+func TestGrantReportingFromJSONWithOptions(t *testing.T) {
+	t.Setenv(ia.NonInteractiveEnv, "false")
+	t.Setenv("CI", "false")
+	t.Setenv("REPORTING_ROLE", "")
+	t.Setenv("REPORTING_CONN_STRING", "")
+
+	var out strings.Builder
+
+	prompter := ia.NewPrompter(strings.NewReader(
+		"reader\npostgres://reader@127.0.0.1:1/db?connect_timeout=1\n",
+	), &out)
+
+	err := GrantReportingFromJSONWithOptions(context.Background(),
+		[]byte(`["document"]`), GrantReportingOptions{
+			Prompter: prompter,
+		})
+	if err == nil || !strings.Contains(err.Error(), "connect to database") {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+
+	for _, label := range []string{"Reporting role", "Enter connection string"} {
+		if !strings.Contains(out.String(), label) {
+			t.Fatalf("expected the prompter to ask for %q, got %q",
+				label, out.String())
+		}
+	}
+
+	err = GrantReportingFromJSONWithOptions(context.Background(),
+		[]byte(`{"tables":[]}`), GrantReportingOptions{
+			Prompter: prompter,
+		})
+	if err == nil || !strings.Contains(err.Error(), "unmarshal reporting tables") {
+		t.Fatalf("expected an unmarshal error, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+
+	"github.com/ttab/mage/internal"
+)
+
+// SqlcOverride is a sqlc type override. Either DBType or Column must be set.
+type SqlcOverride struct {
+	// DBType is the database type to override, f.ex. "jsonb".
+	DBType string `json:"db_type,omitempty"`
+	// Column is the column to override, f.ex. "document.meta".
+	Column string `json:"column,omitempty"`
+	// GoType is the fully qualified Go type, f.ex.
+	// "github.com/ttab/newsdoc.Document".
+	GoType string `json:"go_type"`
+	// Nullable applies the override to nullable columns.
+	Nullable bool `json:"nullable,omitempty"`
+}
+
+// DefaultSqlcOverrides are the type overrides that are included in the
+// default sqlc config.
+var DefaultSqlcOverrides = []SqlcOverride{
+	{DBType: "uuid", GoType: "github.com/google/uuid.UUID"},
+}
+
+// sqlcPackage is a sqlc query file and its Go output directory.
+type sqlcPackage struct {
+	Queries string
+	Out     string
+}
+
+// SqlcConfigWithOverrides writes the default sqlc config with the provided
+// type overrides merged into the default overrides. An override replaces a
+// default override for the same type or column. A package for
+// "postgres/queries.sql" is configured if there are no query files yet.
+func SqlcConfigWithOverrides(overrides []SqlcOverride) error {
+	packages, err := sqlcPackages()
+	if err != nil {
+		return err
+	}
+
+	// Configure the default package so that sqlc can be set up before
+	// the first query has been written.
+	if len(packages) == 0 {
+		packages = []sqlcPackage{{
+			Queries: "postgres/queries.sql",
+			Out:     "postgres",
+		}}
+	}
+
+	merged, err := mergeSqlcOverrides(DefaultSqlcOverrides, overrides)
+	if err != nil {
+		return err
+	}
+
+	config, err := renderSqlcConfig(packages, merged)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile("sqlc.yaml", config, 0o600)
+	if err != nil {
+		return fmt.Errorf("write sqlc.yaml: %w", err)
+	}
+
+	return nil
+}
+
+// renderSqlcConfig renders the sqlc config for the packages and overrides.
+func renderSqlcConfig(
+	packages []sqlcPackage, overrides []SqlcOverride,
+) ([]byte, error) {
+	tpl, err := template.New("sqlc.yaml").Parse(sqlcConfigTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	err = tpl.Execute(&buf, struct {
+		Packages  []sqlcPackage
+		Overrides []SqlcOverride
+	}{
+		Packages:  packages,
+		Overrides: overrides,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("templating error: %w", err)
+	}
+
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
+
+// sqlcPackages discovers the query files of the project.
+func sqlcPackages() ([]sqlcPackage, error) {
+	var packages []sqlcPackage
+
+	root := filepath.Join("postgres", "queries.sql")
+
+	exists, err := internal.FileExists(root)
+	if err != nil {
+		return nil, fmt.Errorf("check for query file: %w", err)
+	}
+
+	if exists {
+		packages = append(packages, sqlcPackage{
+			Queries: root,
+			Out:     "postgres",
+		})
+	}
+
+	nested, err := filepath.Glob(filepath.Join("postgres", "*", "queries.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("glob for query files: %w", err)
+	}
+
+	slices.Sort(nested)
+
+	for _, file := range nested {
+		packages = append(packages, sqlcPackage{
+			Queries: filepath.ToSlash(file),
+			Out:     filepath.ToSlash(filepath.Dir(file)),
+		})
+	}
+
+	return packages, nil
+}
+
+func readSqlcOverrides(name string) ([]SqlcOverride, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read sqlc overrides: %w", err)
+	}
+
+	var overrides []SqlcOverride
+
+	err = json.Unmarshal(data, &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal sqlc overrides: %w", err)
+	}
+
+	return overrides, nil
+}
+
+func mergeSqlcOverrides(
+	defaults []SqlcOverride, overrides []SqlcOverride,
+) ([]SqlcOverride, error) {
+	merged := slices.Clone(defaults)
+
+	for _, o := range overrides {
+		if (o.DBType == "") == (o.Column == "") {
+			return nil, fmt.Errorf(
+				"override for %q must have either a db_type or a column",
+				o.GoType)
+		}
+
+		if o.GoType == "" {
+			return nil, errors.New("override without go_type")
+		}
+
+		idx := slices.IndexFunc(merged, func(m SqlcOverride) bool {
+			return m.DBType == o.DBType &&
+				m.Column == o.Column &&
+				m.Nullable == o.Nullable
+		})
+
+		if idx == -1 {
+			merged = append(merged, o)
+
+			continue
+		}
+
+		merged[idx] = o
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,158 @@
+package sql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeSqlcOverrides(t *testing.T) {
+	defaults := []SqlcOverride{
+		{DBType: "uuid", GoType: "github.com/google/uuid.UUID"},
+		{DBType: "jsonb", GoType: "encoding/json.RawMessage"},
+	}
+
+	cases := []struct {
+		name      string
+		overrides []SqlcOverride
+		want      []SqlcOverride
+		err       string
+	}{
+		{
+			name: "no overrides",
+			want: defaults,
+		},
+		{
+			name: "replaces type",
+			overrides: []SqlcOverride{
+				{DBType: "jsonb", GoType: "github.com/ttab/newsdoc.Document"},
+			},
+			want: []SqlcOverride{
+				{DBType: "uuid", GoType: "github.com/google/uuid.UUID"},
+				{DBType: "jsonb", GoType: "github.com/ttab/newsdoc.Document"},
+			},
+		},
+		{
+			name: "nullable is separate",
+			overrides: []SqlcOverride{
+				{DBType: "uuid", GoType: "github.com/google/uuid.NullUUID", Nullable: true},
+			},
+			want: []SqlcOverride{
+				{DBType: "uuid", GoType: "github.com/google/uuid.UUID"},
+				{DBType: "jsonb", GoType: "encoding/json.RawMessage"},
+				{DBType: "uuid", GoType: "github.com/google/uuid.NullUUID", Nullable: true},
+			},
+		},
+		{
+			name: "adds column",
+			overrides: []SqlcOverride{
+				{Column: "document.meta", GoType: "time.Time"},
+				{Column: "document.meta", GoType: "encoding/json.RawMessage"},
+			},
+			want: []SqlcOverride{
+				{DBType: "uuid", GoType: "github.com/google/uuid.UUID"},
+				{DBType: "jsonb", GoType: "encoding/json.RawMessage"},
+				{Column: "document.meta", GoType: "encoding/json.RawMessage"},
+			},
+		},
+		{
+			name: "both type and column",
+			overrides: []SqlcOverride{
+				{DBType: "jsonb", Column: "document.meta", GoType: "time.Time"},
+			},
+			err: `override for "time.Time" must have either a db_type or a column`,
+		},
+		{
+			name: "neither type nor column",
+			overrides: []SqlcOverride{
+				{GoType: "time.Time"},
+			},
+			err: `override for "time.Time" must have either a db_type or a column`,
+		},
+		{
+			name: "missing go type",
+			overrides: []SqlcOverride{
+				{DBType: "jsonb"},
+			},
+			err: "override without go_type",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := mergeSqlcOverrides(defaults, c.overrides)
+
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+
+	if defaults[1].GoType != "encoding/json.RawMessage" {
+		t.Fatal("the defaults were modified")
+	}
+}
+
+func TestRenderSqlcConfig(t *testing.T) {
+	config, err := renderSqlcConfig([]sqlcPackage{
+		{Queries: "postgres/queries.sql", Out: "postgres"},
+		{Queries: "postgres/search/queries.sql", Out: "postgres/search"},
+	}, DefaultSqlcOverrides)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `version: "2"
+sql:
+- schema: "postgres/schema.sql"
+  queries: "postgres/queries.sql"
+  engine: "postgresql"
+  database:
+    uri: "${POSTGRESQL_SERVER_URI}"
+  analyzer:
+    database: false
+  rules: []
+  gen:
+    go:
+      out: "postgres"
+      sql_package: "pgx/v5"
+      rename:
+        uuid: UUID
+      overrides:
+        - db_type: "uuid"
+          go_type: "github.com/google/uuid.UUID"
+- schema: "postgres/schema.sql"
+  queries: "postgres/search/queries.sql"
+  engine: "postgresql"
+  database:
+    uri: "${POSTGRESQL_SERVER_URI}"
+  analyzer:
+    database: false
+  rules: []
+  gen:
+    go:
+      out: "postgres/search"
+      sql_package: "pgx/v5"
+      rename:
+        uuid: UUID
+      overrides:
+        - db_type: "uuid"
+          go_type: "github.com/google/uuid.UUID"
+
+`
+
+	if string(config) != want {
+		t.Fatalf("expected config:\n%s\ngot:\n%s", want, config)
+	}
+}
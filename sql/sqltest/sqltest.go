@@ -0,0 +1,38 @@
+// Package sqltest provides databases for integration tests.
+package sqltest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ttab/mage/sql"
+)
+
+// DB creates a uniquely named database and login role on the local Postgres
+// instance and migrates it to the latest version. The database is dropped
+// when the test finishes. Returns the connection string for the database.
+func DB(t testing.TB) string {
+	t.Helper()
+
+	return DBWithOptions(t, sql.TestDBOptions{})
+}
+
+// DBWithOptions works like DB but allows control over where migrations are
+// loaded from and whether template databases are used.
+func DBWithOptions(t testing.TB, opts sql.TestDBOptions) string {
+	t.Helper()
+
+	connString, drop, err := sql.CreateTestDB(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("create test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := drop(context.Background())
+		if err != nil {
+			t.Errorf("drop test database: %v", err)
+		}
+	})
+
+	return connString
+}
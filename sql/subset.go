@@ -0,0 +1,609 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ttab/mage/ia"
+)
+
+// SubsetSpec describes a subset of the rows in a database.
+type SubsetSpec struct {
+	// Seeds are the queries that select the initial rows, rows referenced
+	// through foreign keys will be added to the subset.
+	Seeds []SubsetSeed `json:"seeds"`
+	// Masks are applied to the rows before they're written to the local
+	// database.
+	Masks []MaskRule `json:"masks"`
+}
+
+// SubsetSeed selects rows from a table.
+type SubsetSeed struct {
+	Table string `json:"table"`
+	// Where is an optional SQL condition for the rows.
+	Where string `json:"where"`
+	// Limit is the maximum number of rows to select, defaults to 100.
+	Limit int `json:"limit"`
+}
+
+// MaskRule applies a named mask to a column.
+type MaskRule struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Mask   string `json:"mask"`
+}
+
+// MaskFunc masks a non-NULL column value, returning nil will set the value to
+// NULL.
+type MaskFunc func(value string) *string
+
+var masks = map[string]MaskFunc{
+	"null": func(_ string) *string {
+		return nil
+	},
+	"redact": func(_ string) *string {
+		return ptr("REDACTED")
+	},
+	"hash": func(value string) *string {
+		return ptr(shortHash(value, 16))
+	},
+	"email": func(value string) *string {
+		return ptr("user-" + shortHash(value, 8) + "@example.com")
+	},
+	"name": func(value string) *string {
+		return ptr("Person " + shortHash(value, 6))
+	},
+}
+
+// RegisterMask registers a mask that can be used in subset specifications.
+// The built in masks are "null", "redact", "hash", "email", and "name".
+func RegisterMask(name string, fn MaskFunc) {
+	masks[name] = fn
+}
+
+// Subset copies a referentially consistent subset of the rows in a source
+// database to the local database. The source connection string is read from
+// SUBSET_SOURCE_CONN_STRING or prompted for. The subset is described by the
+// JSON spec file, f.ex:
+//
+//	{
+//	  "seeds": [{"table": "document", "where": "created > now() - interval '1 day'"}],
+//	  "masks": [{"table": "author", "column": "email", "mask": "email"}]
+//	}
+//
+// Rows that already exist in the local database are skipped.
+func Subset(ctx context.Context, specFile string) error {
+	data, err := os.ReadFile(specFile)
+	if err != nil {
+		return fmt.Errorf("read spec file: %w", err)
+	}
+
+	var spec SubsetSpec
+
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		return fmt.Errorf("unmarshal spec file: %w", err)
+	}
+
+	source, err := ia.Resolve(ia.Prompt{
+		Label:    "Enter source connection string",
+		Key:      "SUBSET_SOURCE_CONN_STRING",
+		Secret:   true,
+		Validate: validateConnString,
+		Required: true,
+	})
+	if err != nil {
+		return fmt.Errorf("get source connection string: %w", err)
+	}
+
+	err = ensurePostgres(ctx)
+	if err != nil {
+		return err
+	}
+
+	return CopySubset(ctx, source, MustGetConnString(), spec)
+}
+
+// CopySubset copies a referentially consistent subset of the rows in the
+// source database to the destination database. Starting with the rows selected
+// by the seed queries, all rows that they reference through foreign keys are
+// added to the subset. All rows are read from the same snapshot of the source
+// database.
+//
+// Masks are applied after the subset has been collected, masking key columns
+// will break the references between the rows.
+func CopySubset(
+	ctx context.Context, source string, dest string, spec SubsetSpec,
+) error {
+	if len(spec.Seeds) == 0 {
+		return errors.New("no seeds in subset spec")
+	}
+
+	maskFuncs := make(map[string]map[string]MaskFunc)
+
+	for _, rule := range spec.Masks {
+		fn, ok := masks[rule.Mask]
+		if !ok {
+			return fmt.Errorf("unknown mask %q", rule.Mask)
+		}
+
+		if maskFuncs[rule.Table] == nil {
+			maskFuncs[rule.Table] = make(map[string]MaskFunc)
+		}
+
+		maskFuncs[rule.Table][rule.Column] = fn
+	}
+
+	src, err := connect(ctx, source)
+	if err != nil {
+		return fmt.Errorf("connect to source database: %w", err)
+	}
+
+	defer src.Close(ctx)
+
+	srcTx, err := src.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return fmt.Errorf("start source transaction: %w", err)
+	}
+
+	defer func() {
+		_ = srcTx.Rollback(ctx)
+	}()
+
+	sub, err := newSubset(ctx, srcTx)
+	if err != nil {
+		return err
+	}
+
+	for _, seed := range spec.Seeds {
+		err := sub.addSeed(ctx, seed)
+		if err != nil {
+			return fmt.Errorf("select rows from %q: %w", seed.Table, err)
+		}
+	}
+
+	for name, columns := range maskFuncs {
+		table, err := sub.table(ctx, name)
+		if err != nil {
+			return fmt.Errorf("resolve masked table: %w", err)
+		}
+
+		t := sub.tables[table]
+
+		for column, fn := range columns {
+			idx := t.columnIndex(column)
+			if idx == -1 {
+				return fmt.Errorf(
+					"mask for unknown column %q in %q",
+					column, table)
+			}
+
+			for _, row := range t.rows {
+				v, ok := row[idx].(string)
+				if !ok {
+					continue
+				}
+
+				masked := fn(v)
+				if masked == nil {
+					row[idx] = nil
+				} else {
+					row[idx] = *masked
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(sub.tables))
+
+	for name := range sub.tables {
+		names = append(names, name)
+	}
+
+	order, err := topoSort(names, sub.dependencies())
+	if err != nil {
+		return err
+	}
+
+	dst, err := connect(ctx, dest)
+	if err != nil {
+		return fmt.Errorf("connect to destination database: %w", err)
+	}
+
+	defer dst.Close(ctx)
+
+	tx, err := dst.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	for _, name := range order {
+		t := sub.tables[name]
+
+		// The rows are copied with their identity values to keep the
+		// references between them intact.
+		n, err := insertRows(ctx, tx, name, t.columns, t.rows, true)
+		if err != nil {
+			return fmt.Errorf("copy rows to %q: %w", name, err)
+		}
+
+		fmt.Printf("%s: inserted %d of %d rows\n", name, n, len(t.rows))
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+type foreignKey struct {
+	Table      string
+	Columns    []string
+	References string
+	RefColumns []string
+}
+
+type subsetTable struct {
+	columns []string
+	types   []string
+	rows    [][]any
+	seen    map[string]bool
+}
+
+func (t *subsetTable) columnIndex(name string) int {
+	for i := range t.columns {
+		if t.columns[i] == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// fetchBatchSize is the maximum number of referenced rows to fetch in one
+// query.
+const fetchBatchSize = 1000
+
+type subset struct {
+	tx          pgx.Tx
+	foreignKeys map[string][]foreignKey
+	tables      map[string]*subsetTable
+	fetched     map[string]bool
+}
+
+func newSubset(ctx context.Context, tx pgx.Tx) (*subset, error) {
+	rows, err := tx.Query(ctx, `
+SELECT c.conrelid::regclass::text, c.confrelid::regclass::text,
+       array(SELECT a.attname::text
+             FROM unnest(c.conkey) WITH ORDINALITY AS k(attnum, n)
+             JOIN pg_attribute AS a
+                  ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+             ORDER BY k.n),
+       array(SELECT a.attname::text
+             FROM unnest(c.confkey) WITH ORDINALITY AS k(attnum, n)
+             JOIN pg_attribute AS a
+                  ON a.attrelid = c.confrelid AND a.attnum = k.attnum
+             ORDER BY k.n)
+FROM pg_constraint AS c
+WHERE c.contype = 'f'`)
+	if err != nil {
+		return nil, fmt.Errorf("list foreign keys: %w", err)
+	}
+
+	defer rows.Close()
+
+	s := subset{
+		tx:          tx,
+		foreignKeys: make(map[string][]foreignKey),
+		tables:      make(map[string]*subsetTable),
+		fetched:     make(map[string]bool),
+	}
+
+	for rows.Next() {
+		var fk foreignKey
+
+		err := rows.Scan(&fk.Table, &fk.References,
+			&fk.Columns, &fk.RefColumns)
+		if err != nil {
+			return nil, fmt.Errorf("read foreign key: %w", err)
+		}
+
+		s.foreignKeys[fk.Table] = append(s.foreignKeys[fk.Table], fk)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("list foreign keys: %w", rows.Err())
+	}
+
+	return &s, nil
+}
+
+func (s *subset) dependencies() map[string][]string {
+	deps := make(map[string][]string)
+
+	for table, fks := range s.foreignKeys {
+		for _, fk := range fks {
+			if fk.References == table {
+				continue
+			}
+
+			deps[table] = append(deps[table], fk.References)
+		}
+	}
+
+	return deps
+}
+
+func (s *subset) addSeed(ctx context.Context, seed SubsetSeed) error {
+	table, err := s.table(ctx, seed.Table)
+	if err != nil {
+		return err
+	}
+
+	limit := seed.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	where := seed.Where
+	if where == "" {
+		where = "true"
+	}
+
+	return s.fetch(ctx, table, fmt.Sprintf(
+		"WHERE %s LIMIT %d", where, limit,
+	))
+}
+
+// table returns the subset table for the table with the given name, loading
+// the table columns from the catalog if necessary.
+func (s *subset) table(ctx context.Context, name string) (string, error) {
+	var canonical string
+
+	err := s.tx.QueryRow(ctx,
+		"SELECT coalesce(to_regclass($1)::text, '')", name,
+	).Scan(&canonical)
+	if err != nil {
+		return "", fmt.Errorf("resolve table name: %w", err)
+	}
+
+	if canonical == "" {
+		return "", fmt.Errorf("the table %q doesn't exist", name)
+	}
+
+	if _, ok := s.tables[canonical]; ok {
+		return canonical, nil
+	}
+
+	var columns, types []string
+
+	err = s.tx.QueryRow(ctx, `
+SELECT array_agg(attname::text ORDER BY attnum),
+       array_agg(format_type(atttypid, NULL) ORDER BY attnum)
+FROM pg_attribute
+WHERE attrelid = $1::regclass
+      AND attnum > 0 AND NOT attisdropped AND attgenerated = ''`,
+		canonical,
+	).Scan(&columns, &types)
+	if err != nil {
+		return "", fmt.Errorf("list columns of %q: %w", canonical, err)
+	}
+
+	s.tables[canonical] = &subsetTable{
+		columns: columns,
+		types:   types,
+		seen:    make(map[string]bool),
+	}
+
+	return canonical, nil
+}
+
+// fetch adds the rows matched by the condition to the subset, and then fetches
+// the rows that they reference.
+func (s *subset) fetch(
+	ctx context.Context, table string, condition string, args ...any,
+) error {
+	t := s.tables[table]
+
+	selects := make([]string, len(t.columns))
+
+	for i := range t.columns {
+		selects[i] = quoteIdentifier(t.columns[i]) + "::text"
+	}
+
+	rows, err := s.tx.Query(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s %s",
+		strings.Join(selects, ", "), table, condition,
+	), args...)
+	if err != nil {
+		return fmt.Errorf("query %q: %w", table, err)
+	}
+
+	defer rows.Close()
+
+	var added [][]any
+
+	for rows.Next() {
+		values := make([]*string, len(t.columns))
+		dest := make([]any, len(values))
+
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return fmt.Errorf("read row from %q: %w", table, err)
+		}
+
+		row := make([]any, len(values))
+
+		for i := range values {
+			if values[i] != nil {
+				row[i] = *values[i]
+			}
+		}
+
+		key := rowKey(row)
+		if t.seen[key] {
+			continue
+		}
+
+		t.seen[key] = true
+		t.rows = append(t.rows, row)
+		added = append(added, row)
+	}
+
+	if rows.Err() != nil {
+		return fmt.Errorf("query %q: %w", table, rows.Err())
+	}
+
+	return s.fetchReferenced(ctx, table, added)
+}
+
+// fetchReferenced adds the rows referenced by the rows to the subset.
+func (s *subset) fetchReferenced(
+	ctx context.Context, table string, rows [][]any,
+) error {
+	t := s.tables[table]
+
+	for _, fk := range s.foreignKeys[table] {
+		var refs [][]any
+
+		for _, row := range rows {
+			values := make([]any, len(fk.Columns))
+
+			for i, col := range fk.Columns {
+				idx := t.columnIndex(col)
+				if idx == -1 {
+					return fmt.Errorf(
+						"unknown column %q in %q", col, table)
+				}
+
+				values[i] = row[idx]
+			}
+
+			// References with NULL values are not enforced.
+			if hasNil(values) {
+				continue
+			}
+
+			key := fk.References + "\x00" +
+				strings.Join(fk.RefColumns, ",") + "\x00" + rowKey(values)
+			if s.fetched[key] {
+				continue
+			}
+
+			s.fetched[key] = true
+			refs = append(refs, values)
+		}
+
+		if len(refs) == 0 {
+			continue
+		}
+
+		refTable, err := s.table(ctx, fk.References)
+		if err != nil {
+			return err
+		}
+
+		for start := 0; start < len(refs); start += fetchBatchSize {
+			batch := refs[start:min(start+fetchBatchSize, len(refs))]
+
+			condition, args, err := referenceCondition(
+				s.tables[refTable], refTable, fk.RefColumns, batch)
+			if err != nil {
+				return err
+			}
+
+			err = s.fetch(ctx, refTable, condition, args...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// referenceCondition returns a condition that matches the rows where the
+// columns have one of the value tuples. The values are passed as text arrays
+// and cast to the column types so that indexes on the columns can be used.
+func referenceCondition(
+	t *subsetTable, table string, columns []string, values [][]any,
+) (string, []any, error) {
+	var (
+		quoted = make([]string, len(columns))
+		arrays = make([]string, len(columns))
+		args   = make([]any, len(columns))
+	)
+
+	for i, col := range columns {
+		idx := t.columnIndex(col)
+		if idx == -1 {
+			return "", nil, fmt.Errorf(
+				"unknown column %q in %q", col, table)
+		}
+
+		column := make([]string, len(values))
+
+		for j := range values {
+			column[j], _ = values[j][i].(string)
+		}
+
+		quoted[i] = quoteIdentifier(col)
+		arrays[i] = fmt.Sprintf("$%d::text[]::%s[]", i+1, t.types[idx])
+		args[i] = column
+	}
+
+	if len(columns) == 1 {
+		return fmt.Sprintf("WHERE %s = ANY(%s)", quoted[0], arrays[0]),
+			args, nil
+	}
+
+	return fmt.Sprintf("WHERE (%s) IN (SELECT * FROM unnest(%s))",
+		strings.Join(quoted, ", "), strings.Join(arrays, ", "),
+	), args, nil
+}
+
+func rowKey(values []any) string {
+	data, _ := json.Marshal(values)
+
+	return string(data)
+}
+
+func hasNil(values []any) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func shortHash(value string, length int) string {
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:])[:length]
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,74 @@
+package sql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReferenceCondition(t *testing.T) {
+	table := subsetTable{
+		columns: []string{"id", "version", "title"},
+		types:   []string{"uuid", "bigint", "text"},
+	}
+
+	cases := []struct {
+		name      string
+		columns   []string
+		values    [][]any
+		condition string
+		args      []any
+		err       string
+	}{
+		{
+			name:      "single column",
+			columns:   []string{"id"},
+			values:    [][]any{{"a"}, {"b"}},
+			condition: `WHERE "id" = ANY($1::text[]::uuid[])`,
+			args:      []any{[]string{"a", "b"}},
+		},
+		{
+			name:      "composite",
+			columns:   []string{"id", "version"},
+			values:    [][]any{{"a", "1"}, {"b", "2"}},
+			condition: `WHERE ("id", "version") IN (SELECT * FROM unnest($1::text[]::uuid[], $2::text[]::bigint[]))`,
+			args: []any{
+				[]string{"a", "b"},
+				[]string{"1", "2"},
+			},
+		},
+		{
+			name:    "unknown column",
+			columns: []string{"missing"},
+			values:  [][]any{{"a"}},
+			err:     `unknown column "missing" in "public.doc"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			condition, args, err := referenceCondition(
+				&table, "public.doc", c.columns, c.values)
+
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if condition != c.condition {
+				t.Fatalf("expected condition %q, got %q",
+					c.condition, condition)
+			}
+
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("expected args %v, got %v", c.args, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package sql
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ttab/mage/internal"
+)
+
+// testDBComment marks the databases created by CreateTestDB, so that
+// DropTestDBs leaves other databases alone.
+const testDBComment = "tt-mage test database"
+
+// TestDBOptions controls how test databases are created.
+type TestDBOptions struct {
+	// Migrations is the directory containing the tern migrations. Defaults
+	// to the "schema" directory in the module root.
+	Migrations string
+	// NoTemplate disables the use of template databases. By default the
+	// migrations are run once into a template database that is then cloned
+	// for each test database.
+	NoTemplate bool
+}
+
+// CreateTestDB creates a uniquely named database and login role on the local
+// Postgres instance and migrates it to the latest version. Returns the
+// connection string for the database and a function that drops it. Use the
+// sqltest package to get test databases that are dropped when the test
+// finishes.
+func CreateTestDB(
+	ctx context.Context, opts TestDBOptions,
+) (string, func(ctx context.Context) error, error) {
+	migrations := opts.Migrations
+	if migrations == "" {
+		root, err := moduleRoot()
+		if err != nil {
+			return "", nil, fmt.Errorf("find module root: %w", err)
+		}
+
+		migrations = filepath.Join(root, "schema")
+	}
+
+	migrations, err := filepath.Abs(migrations)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve migrations directory: %w", err)
+	}
+
+	name, err := randomName("test_")
+	if err != nil {
+		return "", nil, fmt.Errorf("generate database name: %w", err)
+	}
+
+	err = ensurePostgres(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("ensure that postgres is running: %w", err)
+	}
+
+	conn, err := connect(ctx, adminConnString)
+	if err != nil {
+		return "", nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	drop := func(ctx context.Context) error {
+		return dropTestDB(ctx, name)
+	}
+
+	err = setUpTestDB(ctx, conn, name, migrations, opts.NoTemplate)
+	if err != nil {
+		_ = drop(ctx)
+
+		return "", nil, err
+	}
+
+	return LocalConnString(name), drop, nil
+}
+
+// setUpTestDB creates and migrates a test database, either directly or by
+// cloning a migrated template database.
+func setUpTestDB(
+	ctx context.Context, conn *pgx.Conn,
+	name string, migrations string, noTemplate bool,
+) error {
+	if noTemplate {
+		err := createTestDB(ctx, conn, name, "")
+		if err != nil {
+			return fmt.Errorf("create test database: %w", err)
+		}
+
+		err = migrateDB(migrations, name)
+		if err != nil {
+			return fmt.Errorf("migrate test database: %w", err)
+		}
+
+		return nil
+	}
+
+	template, err := ensureTemplateDB(ctx, conn, migrations)
+	if err != nil {
+		return fmt.Errorf("create template database: %w", err)
+	}
+
+	err = createTestDB(ctx, conn, name, template)
+	if err != nil {
+		return fmt.Errorf("create test database: %w", err)
+	}
+
+	return nil
+}
+
+// DropTestDBs drops all test and template databases created by
+// CreateTestDB.
+func DropTestDBs() error {
+	ctx := context.Background()
+
+	conn, err := connect(ctx, adminConnString)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `
+SELECT datname FROM pg_database
+WHERE datname ~ '^(test_[0-9a-f]{12}|tmpl_[0-9a-f]{16})$'
+      AND shobj_description(oid, 'pg_database') = $1`,
+		testDBComment)
+	if err != nil {
+		return fmt.Errorf("list test databases: %w", err)
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("list test databases: %w", err)
+	}
+
+	for _, name := range names {
+		err := dropTestDB(ctx, name)
+		if err != nil {
+			return fmt.Errorf("drop %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureTemplateDB creates a migrated template database for the current
+// state of the migrations unless it already exists.
+func ensureTemplateDB(
+	ctx context.Context, conn *pgx.Conn, migrations string,
+) (string, error) {
+	hash, err := hashMigrations(migrations)
+	if err != nil {
+		return "", err
+	}
+
+	name := "tmpl_" + hash[:16]
+
+	// Serialise template creation between test packages that run in
+	// parallel.
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext($1))", name)
+	if err != nil {
+		return "", fmt.Errorf("acquire template lock: %w", err)
+	}
+
+	defer func() {
+		_, _ = conn.Exec(ctx,
+			"SELECT pg_advisory_unlock(hashtext($1))", name)
+	}()
+
+	var exists bool
+
+	err = conn.QueryRow(ctx, `
+SELECT EXISTS (
+       SELECT FROM pg_database WHERE datname = $1 AND datistemplate
+)`, name).Scan(&exists)
+	if err != nil {
+		return "", fmt.Errorf("check for template database: %w", err)
+	}
+
+	if exists {
+		return name, nil
+	}
+
+	// Clean up after a previously failed attempt.
+	err = dropTestDB(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	err = createTestDB(ctx, conn, name, "")
+	if err != nil {
+		return "", err
+	}
+
+	err = migrateDB(migrations, name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"ALTER DATABASE %s WITH is_template true",
+		quoteIdentifier(name),
+	))
+	if err != nil {
+		return "", fmt.Errorf("mark database as template: %w", err)
+	}
+
+	return name, nil
+}
+
+// createTestDB creates a database and login role with the same name,
+// optionally cloning a template database.
+func createTestDB(
+	ctx context.Context, conn *pgx.Conn, name string, template string,
+) error {
+	_, err := conn.Exec(ctx, fmt.Sprintf(
+		"CREATE ROLE %s WITH LOGIN PASSWORD 'pass'",
+		quoteIdentifier(name),
+	))
+	if err != nil {
+		return fmt.Errorf("create login role: %w", err)
+	}
+
+	create := fmt.Sprintf("CREATE DATABASE %s WITH OWNER %s",
+		quoteIdentifier(name), quoteIdentifier(name))
+
+	if template != "" {
+		create += " TEMPLATE " + quoteIdentifier(template)
+	}
+
+	_, err = conn.Exec(ctx, create)
+	if err != nil {
+		return fmt.Errorf("create database: %w", err)
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"COMMENT ON DATABASE %s IS %s",
+		quoteIdentifier(name), quoteLiteral(testDBComment),
+	))
+	if err != nil {
+		return fmt.Errorf("mark test database: %w", err)
+	}
+
+	if template == "" {
+		return nil
+	}
+
+	// The objects in the cloned database are owned by the template role,
+	// hand them over to the new role.
+	dbConn, err := connect(ctx, adminConnString+"/"+name)
+	if err != nil {
+		return fmt.Errorf("connect to new database: %w", err)
+	}
+
+	defer dbConn.Close(ctx)
+
+	_, err = dbConn.Exec(ctx, fmt.Sprintf(
+		"REASSIGN OWNED BY %s TO %s",
+		quoteIdentifier(template), quoteIdentifier(name),
+	))
+	if err != nil {
+		return fmt.Errorf("reassign object ownership: %w", err)
+	}
+
+	// REASSIGN OWNED also changes the owner of the template database, so
+	// we have to give it back.
+	_, err = dbConn.Exec(ctx, fmt.Sprintf(
+		"ALTER DATABASE %s OWNER TO %s",
+		quoteIdentifier(template), quoteIdentifier(template),
+	))
+	if err != nil {
+		return fmt.Errorf("restore template ownership: %w", err)
+	}
+
+	return nil
+}
+
+func dropTestDB(ctx context.Context, name string) error {
+	conn, err := connect(ctx, adminConnString)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"ALTER DATABASE %s WITH is_template false",
+		quoteIdentifier(name),
+	))
+	if err != nil && !isInvalidCatalogName(err) {
+		return fmt.Errorf("unmark template database: %w", err)
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"DROP DATABASE IF EXISTS %s WITH (FORCE)",
+		quoteIdentifier(name),
+	))
+	if err != nil {
+		return fmt.Errorf("drop database: %w", err)
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"DROP ROLE IF EXISTS %s", quoteIdentifier(name),
+	))
+	if err != nil {
+		return fmt.Errorf("drop login role: %w", err)
+	}
+
+	return nil
+}
+
+// hashMigrations returns a hash of the names and contents of the files in
+// the migrations directory.
+func hashMigrations(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("list migrations: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		names = append(names, e.Name())
+	}
+
+	slices.Sort(names)
+
+	hash := sha256.New()
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", fmt.Errorf("read migration: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(hash, "%s\x00%d\x00", name, len(data))
+		_, _ = hash.Write(data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// moduleRoot finds the closest parent directory that contains a go.mod file.
+func moduleRoot() (string, error) {
+	dir := internal.MustGetWD()
+
+	for {
+		exists, err := internal.FileExists(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return "", err
+		}
+
+		if exists {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no go.mod found")
+		}
+
+		dir = parent
+	}
+}
+
+func randomName(prefix string) (string, error) {
+	b := make([]byte, 6)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("read random bytes: %w", err)
+	}
+
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// isInvalidCatalogName is true if the error is caused by a database that
+// doesn't exist.
+func isInvalidCatalogName(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == "3D000"
+}
@@ -0,0 +1,216 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/magefile/mage/sh"
+	"github.com/ttab/mage/internal"
+)
+
+// vetRule is a built in check for sqlc queries.
+type vetRule struct {
+	Name string
+	// Check returns the offset in the query and a message if the query
+	// breaks the rule. Queries are checked in file order.
+	Check func(q namedQuery) (offset int, message string)
+}
+
+var (
+	lineCommentExp = regexp.MustCompile(`--[^\n]*`)
+	selectStarExp  = regexp.MustCompile(`(?is)\bselect\s+(distinct\s+)?([a-z_][a-z0-9_]*\.)?\*`)
+	selectExp      = regexp.MustCompile(`(?is)^\s*(with\b.*\bselect|select)\b`)
+	limitExp       = regexp.MustCompile(`(?is)\blimit\b`)
+	vetIgnoreExp   = regexp.MustCompile(`--\s*vet:ignore\s+([a-z, -]+)`)
+	existsOpenExp  = regexp.MustCompile(`(?is)\bexists\s*\(\s*$`)
+)
+
+// vetRules returns the built in checks. The rules keep track of the queries
+// they have seen, so a new set of rules is needed for every run.
+func vetRules() []vetRule {
+	names := make(map[string]namedQuery)
+
+	return []vetRule{
+		{
+			Name:  "select-star",
+			Check: checkSelectStar,
+		},
+		{
+			Name:  "list-limit",
+			Check: checkListLimit,
+		},
+		{
+			Name: "unique-name",
+			Check: func(q namedQuery) (int, string) {
+				prev, dup := names[q.id()]
+				if !dup {
+					names[q.id()] = q
+
+					return 0, ""
+				}
+
+				return 0, fmt.Sprintf("%s is already declared at %s:%d",
+					q.Name, prev.File, prev.Line)
+			},
+		},
+	}
+}
+
+// checkSelectStar forbids SELECT *, except in EXISTS subqueries where the
+// selected columns don't matter.
+func checkSelectStar(q namedQuery) (int, string) {
+	query := stripComments(q.SQL)
+
+	for _, loc := range selectStarExp.FindAllStringIndex(query, -1) {
+		if existsOpenExp.MatchString(query[:loc[0]]) {
+			continue
+		}
+
+		return loc[0], "avoid SELECT *, list the columns explicitly"
+	}
+
+	return 0, ""
+}
+
+// checkListLimit requires a LIMIT on :many select queries.
+func checkListLimit(q namedQuery) (int, string) {
+	if q.Command != ":many" {
+		return 0, ""
+	}
+
+	query := stripComments(q.SQL)
+
+	if !selectExp.MatchString(query) || limitExp.MatchString(query) {
+		return 0, ""
+	}
+
+	return 0, "list queries must have a LIMIT"
+}
+
+// Vet checks the sqlc queries for common problems and then runs "sqlc vet"
+// against the local database.
+//
+// The built in checks forbid SELECT * outside of EXISTS subqueries
+// (select-star), require a LIMIT on :many queries (list-limit), and require
+// query names to be unique within a package (unique-name). Individual checks
+// can be skipped for a query with a "-- vet:ignore select-star, list-limit"
+// comment, or for all queries by listing them in SQL_VET_SKIP. Add "sqlc" to
+// SQL_VET_SKIP to skip running "sqlc vet".
+//
+// Rules for "sqlc vet" are configured in sqlc.yaml, the connection string is
+// available as ${POSTGRESQL_SERVER_URI} for use in the database
+// configuration.
+func Vet() error {
+	skip := strings.Split(os.Getenv("SQL_VET_SKIP"), ",")
+
+	for i := range skip {
+		skip[i] = strings.TrimSpace(skip[i])
+	}
+
+	files, err := queryFiles()
+	if err != nil {
+		return err
+	}
+
+	var (
+		problems int
+		rules    = vetRules()
+	)
+
+	report := func(q namedQuery, offset int, rule, msg string) {
+		problems++
+
+		line := q.BodyLine + strings.Count(q.SQL[:offset], "\n")
+
+		fmt.Printf("%s:%d: %s: %s\n", q.File, line, rule, msg)
+	}
+
+	for _, file := range files {
+		queries, err := parseQueryFile(file)
+		if err != nil {
+			return fmt.Errorf("parse %q: %w", file, err)
+		}
+
+		for _, q := range queries {
+			ignored := ignoredRules(q)
+
+			for _, rule := range rules {
+				if slices.Contains(skip, rule.Name) ||
+					slices.Contains(ignored, rule.Name) {
+					continue
+				}
+
+				offset, msg := rule.Check(q)
+				if msg != "" {
+					report(q, offset, rule.Name, msg)
+				}
+			}
+		}
+	}
+
+	if !slices.Contains(skip, "sqlc") {
+		err = sqlcVet()
+		if err != nil {
+			return err
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problems in the queries", problems)
+	}
+
+	return nil
+}
+
+// sqlcVet runs "sqlc vet" in docker with host networking and the connection
+// string in the POSTGRESQL_SERVER_URI environment variable.
+func sqlcVet() error {
+	err := ensurePostgres(context.Background())
+	if err != nil {
+		return err
+	}
+
+	uid := os.Getuid()
+	gid := os.Getgid()
+	cwd := internal.MustGetWD()
+
+	env := map[string]string{
+		"POSTGRESQL_SERVER_URI": MustGetConnString(),
+	}
+
+	err = sh.RunWith(env, "docker", "run", "--rm",
+		"-v", fmt.Sprintf("%s:/usr/src", cwd),
+		"-u", fmt.Sprintf("%d:%d", uid, gid),
+		"--network", "host",
+		"-e", "POSTGRESQL_SERVER_URI",
+		sqlTools, "sqlc", "vet",
+	)
+	if err != nil {
+		return fmt.Errorf("sqlc vet: %w", err)
+	}
+
+	return nil
+}
+
+func ignoredRules(q namedQuery) []string {
+	var rules []string
+
+	for _, m := range vetIgnoreExp.FindAllStringSubmatch(q.SQL, -1) {
+		for _, r := range strings.Split(m[1], ",") {
+			rules = append(rules, strings.TrimSpace(r))
+		}
+	}
+
+	return rules
+}
+
+// stripComments blanks out line comments while preserving offsets.
+func stripComments(query string) string {
+	return lineCommentExp.ReplaceAllStringFunc(query, func(s string) string {
+		return strings.Repeat(" ", len(s))
+	})
+}
@@ -0,0 +1,97 @@
+package sql
+
+import "testing"
+
+func TestVetRules(t *testing.T) {
+	cases := []struct {
+		name    string
+		rule    string
+		queries []namedQuery
+		want    []string
+	}{
+		{
+			name: "select star",
+			rule: "select-star",
+			queries: []namedQuery{
+				{Name: "A", Command: ":one", SQL: "SELECT * FROM document"},
+				{Name: "B", Command: ":one", SQL: "SELECT d.* FROM document AS d"},
+				{Name: "C", Command: ":one", SQL: "SELECT id FROM document -- SELECT *"},
+			},
+			want: []string{
+				"avoid SELECT *, list the columns explicitly",
+				"avoid SELECT *, list the columns explicitly",
+				"",
+			},
+		},
+		{
+			name: "select star in exists",
+			rule: "select-star",
+			queries: []namedQuery{
+				{
+					Name: "A", Command: ":one",
+					SQL: "SELECT EXISTS (SELECT * FROM document WHERE id = $1)",
+				},
+				{
+					Name: "B", Command: ":many",
+					SQL: "SELECT id FROM d WHERE NOT exists(\n  select * FROM x) LIMIT 1",
+				},
+				{
+					Name: "C", Command: ":one",
+					SQL: "SELECT * FROM d WHERE EXISTS (SELECT * FROM x)",
+				},
+			},
+			want: []string{
+				"",
+				"",
+				"avoid SELECT *, list the columns explicitly",
+			},
+		},
+		{
+			name: "list limit",
+			rule: "list-limit",
+			queries: []namedQuery{
+				{Name: "A", Command: ":many", SQL: "SELECT id FROM document"},
+				{Name: "B", Command: ":many", SQL: "SELECT id FROM document LIMIT $1"},
+				{Name: "C", Command: ":one", SQL: "SELECT id FROM document"},
+				{Name: "D", Command: ":many", SQL: "DELETE FROM document RETURNING id"},
+			},
+			want: []string{"list queries must have a LIMIT", "", "", ""},
+		},
+		{
+			name: "unique name",
+			rule: "unique-name",
+			queries: []namedQuery{
+				{Name: "A", File: "postgres/queries.sql", Line: 1},
+				{Name: "B", File: "postgres/queries.sql", Line: 5},
+				{Name: "A", File: "postgres/queries.sql", Line: 9},
+				{Name: "A", File: "postgres/documents/queries.sql", Line: 1},
+			},
+			want: []string{
+				"",
+				"",
+				"A is already declared at postgres/queries.sql:1",
+				"",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var rule vetRule
+
+			for _, r := range vetRules() {
+				if r.Name == c.rule {
+					rule = r
+				}
+			}
+
+			for i, q := range c.queries {
+				_, got := rule.Check(q)
+				if got != c.want[i] {
+					t.Fatalf("%s: expected %q, got %q",
+						q.Name, c.want[i], got)
+				}
+			}
+		})
+	}
+}